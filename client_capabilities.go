@@ -28,7 +28,7 @@ type WorkspaceEditClientCapabilities struct {
 
 	// The failure handling strategy of a client if applying the workspace edit
 	// fails.
-	FailureHandling []FailureHandlingKind `json:"failureHandling,omitempty"`
+	FailureHandling FailureHandlingKind `json:"failureHandling,omitempty"`
 
 	// Whether the client normalizes line endings to the client specific setting.
 	// If set to `true` the client will normalize line ending characters in a
@@ -41,7 +41,7 @@ type WorkspaceEditClientCapabilities struct {
 	// create file, rename file and delete file changes.
 	//
 	// @since 3.16.0
-	ChangeAnnotationSupport struct {
+	ChangeAnnotationSupport *struct {
 		// Whether the client groups edits with equal labels into tree nodes, for
 		// instance all edits labelled with "Changes in Strings" would be a tree
 		// node.
@@ -0,0 +1,231 @@
+package lsp
+
+// The methods below answer common questions about the capabilities of a
+// client. They are safe to call on a nil `*ClientCapabilities` and treat every
+// capability that is missing as unsupported.
+
+// SupportsApplyEdit reports whether the client supports
+// `workspace/applyEdit` requests.
+func (capabilities *ClientCapabilities) SupportsApplyEdit() bool {
+	return capabilities != nil && capabilities.Workspace != nil && capabilities.Workspace.ApplyEdit
+}
+
+// WorkspaceEditCapabilities returns the client's capabilities for workspace
+// edits, or nil if the client didn't send any.
+func (capabilities *ClientCapabilities) WorkspaceEditCapabilities() *WorkspaceEditClientCapabilities {
+	if capabilities == nil || capabilities.Workspace == nil {
+		return nil
+	}
+
+	return capabilities.Workspace.WorkspaceEdit
+}
+
+// SupportsDocumentChanges reports whether the client supports versioned
+// `documentChanges` in workspace edits.
+func (capabilities *ClientCapabilities) SupportsDocumentChanges() bool {
+	edit := capabilities.WorkspaceEditCapabilities()
+	return edit != nil && edit.DocumentChanges
+}
+
+// SupportsResourceOperation reports whether the client supports the given kind
+// of resource operations in workspace edits.
+func (capabilities *ClientCapabilities) SupportsResourceOperation(kind ResourceOperationKind) bool {
+	return supportsResourceOperation(capabilities.WorkspaceEditCapabilities(), kind)
+}
+
+// SupportsWorkspaceFolders reports whether the client supports workspace
+// folders.
+func (capabilities *ClientCapabilities) SupportsWorkspaceFolders() bool {
+	return capabilities != nil && capabilities.Workspace != nil && capabilities.Workspace.WorkspaceFolders
+}
+
+// SupportsConfiguration reports whether the client supports
+// `workspace/configuration` requests.
+func (capabilities *ClientCapabilities) SupportsConfiguration() bool {
+	return capabilities != nil && capabilities.Workspace != nil && capabilities.Workspace.Configuration
+}
+
+// SupportsWorkDoneProgress reports whether the client supports work done
+// progress reported by the server.
+func (capabilities *ClientCapabilities) SupportsWorkDoneProgress() bool {
+	return capabilities != nil && capabilities.Window != nil && capabilities.Window.WorkDoneProgress
+}
+
+// SupportsShowDocument reports whether the client supports
+// `window/showDocument` requests.
+func (capabilities *ClientCapabilities) SupportsShowDocument() bool {
+	return capabilities != nil && capabilities.Window != nil &&
+		capabilities.Window.ShowDocument != nil && capabilities.Window.ShowDocument.Support
+}
+
+// CompletionCapabilities returns the client's capabilities for completion, or
+// nil if the client didn't send any.
+func (capabilities *ClientCapabilities) CompletionCapabilities() *CompletionClientCapabilities {
+	if capabilities == nil || capabilities.TextDocument == nil {
+		return nil
+	}
+
+	return capabilities.TextDocument.Completion
+}
+
+// SupportsSnippets reports whether the client supports snippets as the insert
+// text of completion items.
+func (capabilities *ClientCapabilities) SupportsSnippets() bool {
+	completion := capabilities.CompletionCapabilities()
+	return completion != nil && completion.CompletionItem.SnippetSupport
+}
+
+// SupportsMarkdownCompletionDocumentation reports whether the client supports
+// Markdown in the documentation of completion items.
+func (capabilities *ClientCapabilities) SupportsMarkdownCompletionDocumentation() bool {
+	completion := capabilities.CompletionCapabilities()
+	return completion != nil && containsMarkupKind(completion.CompletionItem.DocumentationFormat, MKMarkdown)
+}
+
+// SupportsMarkdownHover reports whether the client supports Markdown in the
+// contents of hovers.
+func (capabilities *ClientCapabilities) SupportsMarkdownHover() bool {
+	if capabilities == nil || capabilities.TextDocument == nil || capabilities.TextDocument.Hover == nil {
+		return false
+	}
+
+	return containsMarkupKind(capabilities.TextDocument.Hover.ContentFormat, MKMarkdown)
+}
+
+// SupportsHierarchicalSymbols reports whether the client supports
+// hierarchical `DocumentSymbol`s in `textDocument/documentSymbol` responses.
+func (capabilities *ClientCapabilities) SupportsHierarchicalSymbols() bool {
+	if capabilities == nil || capabilities.TextDocument == nil || capabilities.TextDocument.DocumentSymbol == nil {
+		return false
+	}
+
+	return capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport
+}
+
+// SupportsCodeActionLiterals reports whether the client supports `CodeAction`
+// literals in `textDocument/codeAction` responses, rather than just commands.
+func (capabilities *ClientCapabilities) SupportsCodeActionLiterals() bool {
+	if capabilities == nil || capabilities.TextDocument == nil || capabilities.TextDocument.CodeAction == nil {
+		return false
+	}
+
+	return len(capabilities.TextDocument.CodeAction.CodeActionLiteralSupport.CodeActionKind.ValueSet) > 0
+}
+
+// SupportsPrepareRename reports whether the client supports
+// `textDocument/prepareRename` requests.
+func (capabilities *ClientCapabilities) SupportsPrepareRename() bool {
+	if capabilities == nil || capabilities.TextDocument == nil || capabilities.TextDocument.Rename == nil {
+		return false
+	}
+
+	return capabilities.TextDocument.Rename.PrepareSupport
+}
+
+// SupportsDiagnosticRelatedInformation reports whether the client supports
+// the related information of diagnostics.
+func (capabilities *ClientCapabilities) SupportsDiagnosticRelatedInformation() bool {
+	if capabilities == nil || capabilities.TextDocument == nil || capabilities.TextDocument.PublishDiagnostics == nil {
+		return false
+	}
+
+	return capabilities.TextDocument.PublishDiagnostics.RelatedInformation
+}
+
+// SupportsDynamicRegistration reports whether the client supports registering
+// the given method dynamically via `client/registerCapability`. Methods that
+// can't be registered dynamically are reported as unsupported.
+func (capabilities *ClientCapabilities) SupportsDynamicRegistration(method string) bool {
+	if capabilities == nil {
+		return false
+	}
+
+	if workspace := capabilities.Workspace; workspace != nil {
+		switch method {
+		case "workspace/didChangeConfiguration":
+			return workspace.DidChangeConfiguration != nil && workspace.DidChangeConfiguration.DynamicRegistration
+		case "workspace/didChangeWatchedFiles":
+			return workspace.DidChangeWatchedFiles != nil && workspace.DidChangeWatchedFiles.DynamicRegistration
+		case "workspace/symbol":
+			return workspace.Symbol != nil && workspace.Symbol.DynamicRegistration
+		case "workspace/executeCommand":
+			return workspace.ExecuteCommand != nil && workspace.ExecuteCommand.DynamicRegistration
+		case "workspace/didCreateFiles", "workspace/willCreateFiles",
+			"workspace/didRenameFiles", "workspace/willRenameFiles",
+			"workspace/didDeleteFiles", "workspace/willDeleteFiles":
+			return workspace.FileOperations != nil && workspace.FileOperations.DynamicRegistration
+		}
+	}
+
+	textDocument := capabilities.TextDocument
+	if textDocument == nil {
+		return false
+	}
+
+	switch method {
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose",
+		"textDocument/willSave", "textDocument/willSaveWaitUntil", "textDocument/didSave":
+		return textDocument.Synchronization != nil && textDocument.Synchronization.DynamicRegistration
+	case "textDocument/completion":
+		return textDocument.Completion != nil && textDocument.Completion.DynamicRegistration
+	case "textDocument/hover":
+		return textDocument.Hover != nil && textDocument.Hover.DynamicRegistration
+	case "textDocument/signatureHelp":
+		return textDocument.SignatureHelp != nil && textDocument.SignatureHelp.DynamicRegistration
+	case "textDocument/declaration":
+		return textDocument.Declaration != nil && textDocument.Declaration.DynamicRegistration
+	case "textDocument/definition":
+		return textDocument.Definition != nil && textDocument.Definition.DynamicRegistration
+	case "textDocument/typeDefinition":
+		return textDocument.TypeDefinition != nil && textDocument.TypeDefinition.DynamicRegistration
+	case "textDocument/implementation":
+		return textDocument.Implementation != nil && textDocument.Implementation.DynamicRegistration
+	case "textDocument/references":
+		return textDocument.References != nil && textDocument.References.DynamicRegistration
+	case "textDocument/documentHighlight":
+		return textDocument.DocumentHighlight != nil && textDocument.DocumentHighlight.DynamicRegistration
+	case "textDocument/documentSymbol":
+		return textDocument.DocumentSymbol != nil && textDocument.DocumentSymbol.DynamicRegistration
+	case "textDocument/codeAction":
+		return textDocument.CodeAction != nil && textDocument.CodeAction.DynamicRegistration
+	case "textDocument/codeLens":
+		return textDocument.CodeLens != nil && textDocument.CodeLens.DynamicRegistration
+	case "textDocument/documentLink":
+		return textDocument.DocumentLink != nil && textDocument.DocumentLink.DynamicRegistration
+	case "textDocument/documentColor":
+		return textDocument.ColorProvider != nil && textDocument.ColorProvider.DynamicRegistration
+	case "textDocument/formatting":
+		return textDocument.Formatting != nil && textDocument.Formatting.DynamicRegistration
+	case "textDocument/rangeFormatting":
+		return textDocument.RangeFormatting != nil && textDocument.RangeFormatting.DynamicRegistration
+	case "textDocument/onTypeFormatting":
+		return textDocument.OnTypeFormatting != nil && textDocument.OnTypeFormatting.DynamicRegistration
+	case "textDocument/rename":
+		return textDocument.Rename != nil && textDocument.Rename.DynamicRegistration
+	case "textDocument/foldingRange":
+		return textDocument.FoldingRange != nil && textDocument.FoldingRange.DynamicRegistration
+	case "textDocument/selectionRange":
+		return textDocument.SelectionRange != nil && textDocument.SelectionRange.DynamicRegistration
+	case "textDocument/linkedEditingRange":
+		return textDocument.LinkedEditingRange != nil && textDocument.LinkedEditingRange.DynamicRegistration
+	case "textDocument/prepareCallHierarchy":
+		return textDocument.CallHierarchy != nil && textDocument.CallHierarchy.DynamicRegistration
+	case "textDocument/semanticTokens":
+		return textDocument.SemanticTokens != nil && textDocument.SemanticTokens.DynamicRegistration
+	case "textDocument/moniker":
+		return textDocument.Moniker != nil && textDocument.Moniker.DynamicRegistration
+	}
+
+	return false
+}
+
+// containsMarkupKind reports whether a list of markup kinds contains a kind.
+func containsMarkupKind(kinds []MarkupKind, kind MarkupKind) bool {
+	for _, candidate := range kinds {
+		if candidate == kind {
+			return true
+		}
+	}
+
+	return false
+}
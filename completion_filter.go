@@ -0,0 +1,213 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+)
+
+// Scores awarded by `FuzzyScore` for every matched character.
+const (
+	fuzzyMatchScore       = 1
+	fuzzyStartScore       = 10
+	fuzzyBoundaryScore    = 8
+	fuzzyConsecutiveScore = 5
+	fuzzyCaseScore        = 1
+)
+
+// FuzzyScore reports whether the characters of pattern appear in candidate in
+// the same order, ignoring case, and scores how good the match is. Higher
+// scores are better. Matches at the start of the candidate and at the start of
+// its segments score higher, as do consecutive matches and matches with the
+// same case. Segments start after `_`, `-`, `.`, `/` and whitespace, at an
+// upper case letter following a lower case one (as in camelCase) and at the
+// first digit of a number.
+//
+// An empty pattern matches every candidate with a score of zero.
+func FuzzyScore(pattern, candidate string) (int, bool) {
+	return newFuzzyMatcher(pattern).score(candidate)
+}
+
+// fuzzyMatcher matches a single pattern against many candidates, reusing its
+// buffers between candidates.
+type fuzzyMatcher struct {
+	pattern []rune
+	lower   []rune
+
+	// The best score of a match of the pattern so far, ending anywhere up to
+	// the current candidate character, and ending exactly at it.
+	best    []int
+	current []int
+}
+
+func newFuzzyMatcher(pattern string) *fuzzyMatcher {
+	matcher := &fuzzyMatcher{pattern: []rune(pattern)}
+
+	matcher.lower = make([]rune, len(matcher.pattern))
+	for i, r := range matcher.pattern {
+		matcher.lower[i] = unicode.ToLower(r)
+	}
+
+	matcher.best = make([]int, len(matcher.pattern)+1)
+	matcher.current = make([]int, len(matcher.pattern)+1)
+
+	return matcher
+}
+
+// fuzzyNoMatch marks impossible matches in the tables of a fuzzyMatcher.
+const fuzzyNoMatch = -1 << 30
+
+func (matcher *fuzzyMatcher) score(candidate string) (int, bool) {
+	if len(matcher.pattern) == 0 {
+		return 0, true
+	}
+
+	runes := []rune(candidate)
+	if len(runes) < len(matcher.pattern) {
+		return 0, false
+	}
+
+	for i := range matcher.best {
+		matcher.best[i] = fuzzyNoMatch
+		matcher.current[i] = fuzzyNoMatch
+	}
+
+	matcher.best[0] = 0
+
+	for j, r := range runes {
+		lower := unicode.ToLower(r)
+		bonus := fuzzySegmentBonus(runes, j)
+
+		// Walk the pattern backwards, so best[i-1] and current[i-1] still hold
+		// the values for the previous candidate character.
+		last := len(matcher.pattern)
+		if last > j+1 {
+			last = j + 1
+		}
+
+		for i := last; i >= 1; i-- {
+			if matcher.lower[i-1] != lower {
+				matcher.current[i] = fuzzyNoMatch
+				continue
+			}
+
+			score := matcher.best[i-1]
+			if consecutive := matcher.current[i-1]; i > 1 && consecutive != fuzzyNoMatch && consecutive+fuzzyConsecutiveScore > score {
+				score = consecutive + fuzzyConsecutiveScore
+			}
+
+			if score == fuzzyNoMatch {
+				matcher.current[i] = fuzzyNoMatch
+				continue
+			}
+
+			score += fuzzyMatchScore + bonus
+			if matcher.pattern[i-1] == r {
+				score += fuzzyCaseScore
+			}
+
+			matcher.current[i] = score
+			if score > matcher.best[i] {
+				matcher.best[i] = score
+			}
+		}
+	}
+
+	result := matcher.best[len(matcher.pattern)]
+	if result == fuzzyNoMatch {
+		return 0, false
+	}
+
+	return result, true
+}
+
+// fuzzySegmentBonus returns the bonus for a match at the given index of the
+// candidate, depending on whether a segment starts there.
+func fuzzySegmentBonus(runes []rune, index int) int {
+	if index == 0 {
+		return fuzzyStartScore
+	}
+
+	previous, r := runes[index-1], runes[index]
+
+	switch {
+	case previous == '_' || previous == '-' || previous == '.' || previous == '/' || unicode.IsSpace(previous):
+		return fuzzyBoundaryScore
+	case unicode.IsUpper(r) && unicode.IsLower(previous):
+		return fuzzyBoundaryScore
+	case unicode.IsDigit(r) && !unicode.IsDigit(previous):
+		return fuzzyBoundaryScore
+	}
+
+	return 0
+}
+
+// FilterCompletionList filters and ranks the items of a completion list
+// against the text the user has typed so far. Items are matched using
+// `FuzzyScore` on their `FilterText`, or their `Label` if there is no filter
+// text. Items that don't match are removed.
+//
+// The remaining items are ordered by score, then by their original `SortText`
+// (or `Label`), and get a new `SortText` that preserves this order on the
+// client. If limit is greater than zero, only the best limit items are kept
+// and the list is marked as incomplete, so the client asks again as the user
+// keeps typing. The original list is left untouched.
+func FilterCompletionList(list CompletionList, prefix string, limit int) CompletionList {
+	type candidate struct {
+		item  CompletionItem
+		score int
+		key   string
+	}
+
+	matcher := newFuzzyMatcher(prefix)
+	candidates := []candidate{}
+
+	for _, item := range list.Items {
+		text := item.FilterText
+		if text == "" {
+			text = item.Label
+		}
+
+		score, ok := matcher.score(text)
+		if !ok {
+			continue
+		}
+
+		key := item.SortText
+		if key == "" {
+			key = item.Label
+		}
+
+		candidates = append(candidates, candidate{item: item, score: score, key: key})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+
+		if candidates[i].key != candidates[j].key {
+			return candidates[i].key < candidates[j].key
+		}
+
+		return candidates[i].item.Label < candidates[j].item.Label
+	})
+
+	result := CompletionList{
+		IsIncomplete: list.IsIncomplete,
+		Items:        []CompletionItem{},
+	}
+
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+		result.IsIncomplete = true
+	}
+
+	width := len(fmt.Sprint(len(candidates)))
+	for i, candidate := range candidates {
+		candidate.item.SortText = fmt.Sprintf("%0*d", width, i)
+		result.Items = append(result.Items, candidate.item)
+	}
+
+	return result
+}
@@ -0,0 +1,158 @@
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		candidate string
+		score     int
+		ok        bool
+	}{
+		{"", "anything", 0, true},
+		{"abc", "ab", 0, false},
+		{"ba", "abc", 0, false},
+		{"fb", "fooBar", 21, true},
+		{"fB", "fooBar", 22, true},
+		{"foo", "foo", 26, true},
+		{"FOO", "foo", 23, true},
+		{"b", "xbar", 2, true},
+		{"b", "x.bar", 10, true},
+		{"é", "CAFÉ", 1, true},
+	}
+
+	for _, test := range tests {
+		score, ok := FuzzyScore(test.pattern, test.candidate)
+		if ok != test.ok || score != test.score {
+			t.Errorf("%q in %q: expected %d (%t), got %d (%t)", test.pattern, test.candidate, test.score, test.ok, score, ok)
+		}
+	}
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	tests := []struct {
+		pattern string
+		better  string
+		worse   string
+	}{
+		{"fb", "fooBar", "fabric"},
+		{"b", "bar", "xbar"},
+		{"b", "foo_bar", "foobar"},
+		{"b", "foo-bar", "foobar"},
+		{"b", "foo/bar", "foobar"},
+		{"b", "foo bar", "foobar"},
+		{"2", "v2", "v12"},
+		{"Foo", "Foo", "foo"},
+		{"ab", "xab", "xaxb"},
+		// The best alignment is found, even if an earlier one exists.
+		{"fb", "fxbFooBar", "fxbfoobar"},
+	}
+
+	for _, test := range tests {
+		better, ok := FuzzyScore(test.pattern, test.better)
+		if !ok {
+			t.Errorf("%q doesn't match %q", test.pattern, test.better)
+			continue
+		}
+
+		worse, ok := FuzzyScore(test.pattern, test.worse)
+		if !ok {
+			t.Errorf("%q doesn't match %q", test.pattern, test.worse)
+			continue
+		}
+
+		if better <= worse {
+			t.Errorf("%q: expected %q (%d) to score higher than %q (%d)", test.pattern, test.better, better, test.worse, worse)
+		}
+	}
+}
+
+func TestFilterCompletionList(t *testing.T) {
+	list := CompletionList{
+		Items: []CompletionItem{
+			{Label: "fabric"},
+			{Label: "fooBar", SortText: "b"},
+			{Label: "other"},
+			{Label: "xyz", FilterText: "fooBaz", SortText: "a"},
+		},
+	}
+
+	original := CompletionList{Items: append([]CompletionItem{}, list.Items...)}
+
+	tests := []struct {
+		limit    int
+		expected CompletionList
+	}{
+		{
+			0,
+			CompletionList{
+				Items: []CompletionItem{
+					{Label: "xyz", FilterText: "fooBaz", SortText: "0"},
+					{Label: "fooBar", SortText: "1"},
+					{Label: "fabric", SortText: "2"},
+				},
+			},
+		},
+		{
+			2,
+			CompletionList{
+				IsIncomplete: true,
+				Items: []CompletionItem{
+					{Label: "xyz", FilterText: "fooBaz", SortText: "0"},
+					{Label: "fooBar", SortText: "1"},
+				},
+			},
+		},
+		{
+			3,
+			CompletionList{
+				Items: []CompletionItem{
+					{Label: "xyz", FilterText: "fooBaz", SortText: "0"},
+					{Label: "fooBar", SortText: "1"},
+					{Label: "fabric", SortText: "2"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		filtered := FilterCompletionList(list, "fb", test.limit)
+		if !reflect.DeepEqual(filtered, test.expected) {
+			t.Errorf("limit %d: expected %+v, got %+v", test.limit, test.expected, filtered)
+		}
+	}
+
+	if !reflect.DeepEqual(list, original) {
+		t.Errorf("expected the original list to be left untouched, got %+v", list)
+	}
+
+	if filtered := FilterCompletionList(list, "zzz", 0); len(filtered.Items) != 0 || filtered.Items == nil {
+		t.Errorf("expected an empty list, got %+v", filtered)
+	}
+}
+
+func TestFilterCompletionListSortText(t *testing.T) {
+	list := CompletionList{IsIncomplete: true}
+	for i := 11; i >= 0; i-- {
+		list.Items = append(list.Items, CompletionItem{Label: fmt.Sprintf("item%02d", i)})
+	}
+
+	filtered := FilterCompletionList(list, "", 0)
+	if !filtered.IsIncomplete {
+		t.Error("expected the list to stay incomplete")
+	}
+
+	for i, item := range filtered.Items {
+		if expected := fmt.Sprintf("item%02d", i); item.Label != expected {
+			t.Errorf("expected item %d to be %q, got %q", i, expected, item.Label)
+		}
+
+		if expected := fmt.Sprintf("%02d", i); item.SortText != expected {
+			t.Errorf("expected item %d to have the sort text %q, got %q", i, expected, item.SortText)
+		}
+	}
+}
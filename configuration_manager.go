@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ConfigurationChangeFunc is called when the value of a configuration section
+// changes for a scope. The values are of the type registered for the section.
+type ConfigurationChangeFunc func(scope DocumentURI, oldValue, newValue interface{})
+
+// ConfigurationManager provides typed access to the configuration of the
+// client. Sections are registered along with a Go value holding their
+// defaults, and are decoded into values of the same type.
+//
+// If the client supports `workspace/configuration` requests, sections are
+// fetched on demand for every scope and cached until the client sends a
+// `workspace/didChangeConfiguration` notification. Otherwise, they are taken
+// from the settings pushed along with that notification. If `Folders` is set,
+// values are cached per workspace folder rather than per document.
+//
+// A ConfigurationManager is safe for concurrent use.
+type ConfigurationManager struct {
+	// An optional workspace folder manager used to map scopes to the workspace
+	// folder they belong to.
+	Folders *WorkspaceFolderManager
+
+	conn      Conn
+	supported bool
+
+	mu       sync.Mutex
+	sections map[string]*configurationSection
+	cache    map[configurationKey]interface{}
+	settings interface{}
+
+	// generation is incremented whenever the cache is dropped, so that values
+	// fetched before can't end up in the new cache.
+	generation uint64
+}
+
+// configurationSection is a registered configuration section.
+type configurationSection struct {
+	defaults  interface{}
+	callbacks []ConfigurationChangeFunc
+}
+
+// configurationKey identifies a cached configuration value.
+type configurationKey struct {
+	section string
+	scope   DocumentURI
+}
+
+// NewConfigurationManager instantiates a ConfigurationManager that sends
+// requests over conn. The capabilities tell whether the client supports
+// `workspace/configuration` requests.
+func NewConfigurationManager(conn Conn, capabilities *ClientCapabilities) *ConfigurationManager {
+	return &ConfigurationManager{
+		conn:      conn,
+		supported: capabilities.SupportsConfiguration(),
+		sections:  map[string]*configurationSection{},
+		cache:     map[configurationKey]interface{}{},
+	}
+}
+
+// Register registers a configuration section, like `go.formatting`. The
+// defaults are a value of the Go type the section is decoded into, holding the
+// values of the settings the client leaves out. It can be a struct or a
+// non-nil pointer to one; values returned by `Get` are of the same type.
+func (manager *ConfigurationManager) Register(section string, defaults interface{}) error {
+	value := reflect.ValueOf(defaults)
+	if value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("defaults of configuration section %q have to be a struct or a non-nil pointer to one, got %T", section, defaults)
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.sections[section] = &configurationSection{defaults: defaults}
+	return nil
+}
+
+// OnChange registers a function that's called when the value of a section
+// changes. Changes are only detected for scopes whose value has been fetched
+// before.
+func (manager *ConfigurationManager) OnChange(section string, callback ConfigurationChangeFunc) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	registered, ok := manager.sections[section]
+	if !ok {
+		return fmt.Errorf("configuration section %q is not registered", section)
+	}
+
+	registered.callbacks = append(registered.callbacks, callback)
+	return nil
+}
+
+// Get returns the value of a section for a scope, which is usually the URI of
+// a document or a workspace folder. An empty scope denotes the global
+// configuration. Values are shared with the cache and must not be modified.
+func (manager *ConfigurationManager) Get(ctx context.Context, section string, scope DocumentURI) (interface{}, error) {
+	key := configurationKey{section: section, scope: manager.scopeOf(scope)}
+
+	manager.mu.Lock()
+	if value, ok := manager.cache[key]; ok {
+		manager.mu.Unlock()
+		return value, nil
+	}
+
+	generation := manager.generation
+	manager.mu.Unlock()
+
+	value, err := manager.fetch(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the configuration changed while the value was being fetched, it may
+	// be outdated and isn't cached.
+	manager.mu.Lock()
+	if manager.generation == generation {
+		manager.cache[key] = value
+	}
+	manager.mu.Unlock()
+
+	return value, nil
+}
+
+// DidChangeConfiguration handles a `workspace/didChangeConfiguration`
+// notification. It drops all cached values, fetches the ones that were cached
+// again and calls the change callbacks of the sections whose value changed.
+func (manager *ConfigurationManager) DidChangeConfiguration(ctx context.Context, params *DidChangeConfigurationParams) error {
+	manager.mu.Lock()
+	manager.settings = params.Settings
+
+	previous := manager.cache
+	manager.cache = map[configurationKey]interface{}{}
+	manager.generation++
+	manager.mu.Unlock()
+
+	for key, oldValue := range previous {
+		newValue, err := manager.Get(ctx, key.section, key.scope)
+		if err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		manager.mu.Lock()
+		callbacks := manager.sections[key.section].callbacks
+		manager.mu.Unlock()
+
+		for _, callback := range callbacks {
+			callback(key.scope, oldValue, newValue)
+		}
+	}
+
+	return nil
+}
+
+// scopeOf maps a scope to the workspace folder it belongs to, if any.
+func (manager *ConfigurationManager) scopeOf(scope DocumentURI) DocumentURI {
+	if manager.Folders == nil || scope == "" {
+		return scope
+	}
+
+	if folder, ok := manager.Folders.FolderFor(scope); ok {
+		return DocumentURI(folder.URI)
+	}
+
+	return scope
+}
+
+// fetch retrieves and decodes the value of a section for a scope.
+func (manager *ConfigurationManager) fetch(ctx context.Context, key configurationKey) (interface{}, error) {
+	manager.mu.Lock()
+	registered, ok := manager.sections[key.section]
+	settings := manager.settings
+	manager.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("configuration section %q is not registered", key.section)
+	}
+
+	var raw json.RawMessage
+
+	if manager.supported {
+		params := ConfigurationParams{
+			Items: []ConfigurationItem{{ScopeURI: key.scope, Section: key.section}},
+		}
+
+		var result []json.RawMessage
+		if err := manager.conn.Call(ctx, "workspace/configuration", params, &result); err != nil {
+			return nil, err
+		}
+
+		if len(result) != 1 {
+			return nil, fmt.Errorf("expected 1 configuration value, got %d", len(result))
+		}
+
+		raw = result[0]
+	} else {
+		value, ok := configurationSectionOf(settings, key.section)
+		if ok {
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+
+			raw = encoded
+		}
+	}
+
+	return decodeConfiguration(registered.defaults, raw, key.section)
+}
+
+// configurationSectionOf looks up a dotted section in the settings pushed by
+// the client. Settings are either nested, like `{"go": {"formatting": ...}}`,
+// or use dotted keys, like `{"go.formatting": ...}`.
+func configurationSectionOf(settings interface{}, section string) (interface{}, bool) {
+	if section == "" {
+		return settings, settings != nil
+	}
+
+	object, ok := settings.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	if value, ok := object[section]; ok {
+		return value, true
+	}
+
+	parts := strings.SplitN(section, ".", 2)
+	value, ok := object[parts[0]]
+	if !ok || len(parts) == 1 {
+		return value, ok
+	}
+
+	return configurationSectionOf(value, parts[1])
+}
+
+// decodeConfiguration decodes a raw configuration value on top of a copy of
+// the defaults.
+func decodeConfiguration(defaults interface{}, raw json.RawMessage, section string) (interface{}, error) {
+	valueType := reflect.TypeOf(defaults)
+
+	isPointer := valueType.Kind() == reflect.Ptr
+	elementType := valueType
+	if isPointer {
+		elementType = valueType.Elem()
+	}
+
+	value := reflect.New(elementType)
+
+	// Copy the defaults by encoding them, so that decoding the configuration
+	// doesn't modify maps or slices shared with them.
+	encodedDefaults, err := json.Marshal(defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(encodedDefaults, value.Interface()); err != nil {
+		return nil, err
+	}
+
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, fmt.Errorf("could not decode configuration section %q: %v", section, err)
+		}
+	}
+
+	if isPointer {
+		return value.Interface(), nil
+	}
+
+	return value.Elem().Interface(), nil
+}
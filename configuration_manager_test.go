@@ -0,0 +1,199 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+type testFormatting struct {
+	TabSize int  `json:"tabSize"`
+	UseTabs bool `json:"useTabs"`
+}
+
+// configurationClient answers `workspace/configuration` requests with the
+// formatting settings it holds.
+type configurationClient struct {
+	mu       sync.Mutex
+	settings map[string]interface{}
+	requests int
+}
+
+func (client *configurationClient) set(settings map[string]interface{}) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.settings = settings
+}
+
+func (client *configurationClient) respond(method string, params interface{}) (interface{}, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.requests++
+	return []interface{}{client.settings}, nil
+}
+
+func newTestConfigurationManager(t *testing.T, conn Conn, supported bool) *ConfigurationManager {
+	t.Helper()
+
+	capabilities := &ClientCapabilities{}
+	if supported {
+		if err := json.Unmarshal([]byte(`{"workspace":{"configuration":true}}`), capabilities); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewConfigurationManager(conn, capabilities)
+	if err := manager.Register("go.formatting", testFormatting{TabSize: 4, UseTabs: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	return manager
+}
+
+func TestConfigurationManagerRegister(t *testing.T) {
+	manager := NewConfigurationManager(&recordingConn{}, nil)
+
+	for _, defaults := range []interface{}{nil, (*testFormatting)(nil), 42, map[string]interface{}{}} {
+		if err := manager.Register("section", defaults); err == nil {
+			t.Errorf("defaults %#v have been accepted", defaults)
+		}
+	}
+
+	for _, defaults := range []interface{}{testFormatting{}, &testFormatting{}} {
+		if err := manager.Register("section", defaults); err != nil {
+			t.Errorf("defaults %#v have been rejected: %v", defaults, err)
+		}
+	}
+}
+
+func TestConfigurationManagerRequests(t *testing.T) {
+	ctx := context.Background()
+
+	client := &configurationClient{settings: map[string]interface{}{"tabSize": 2}}
+	manager := newTestConfigurationManager(t, &recordingConn{respond: client.respond}, true)
+
+	var changes []testFormatting
+	if err := manager.OnChange("go.formatting", func(scope DocumentURI, oldValue, newValue interface{}) {
+		changes = append(changes, oldValue.(testFormatting), newValue.(testFormatting))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := manager.Get(ctx, "go.formatting", "file:///a.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != (testFormatting{TabSize: 2, UseTabs: true}) {
+			t.Errorf("expected the settings merged with the defaults, got %+v", value)
+		}
+	}
+
+	if client.requests != 1 {
+		t.Errorf("expected the value to be cached, got %d requests", client.requests)
+	}
+
+	client.set(map[string]interface{}{"tabSize": 8, "useTabs": false})
+	if err := manager.DidChangeConfiguration(ctx, &DidChangeConfigurationParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []testFormatting{{TabSize: 2, UseTabs: true}, {TabSize: 8}}
+	if len(changes) != 2 || changes[0] != expected[0] || changes[1] != expected[1] {
+		t.Errorf("expected change %+v, got %+v", expected, changes)
+	}
+
+	if _, err := manager.Get(ctx, "unknown", ""); err == nil {
+		t.Error("unregistered section has been fetched")
+	}
+}
+
+func TestConfigurationManagerPushedSettings(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestConfigurationManager(t, &recordingConn{}, false)
+
+	value, err := manager.Get(ctx, "go.formatting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != (testFormatting{TabSize: 4, UseTabs: true}) {
+		t.Errorf("expected the defaults, got %+v", value)
+	}
+
+	settings := []interface{}{
+		map[string]interface{}{"go": map[string]interface{}{"formatting": map[string]interface{}{"tabSize": 8}}},
+		map[string]interface{}{"go.formatting": map[string]interface{}{"tabSize": 8}},
+	}
+
+	for _, settings := range settings {
+		if err := manager.DidChangeConfiguration(ctx, &DidChangeConfigurationParams{Settings: settings}); err != nil {
+			t.Fatal(err)
+		}
+
+		value, err := manager.Get(ctx, "go.formatting", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != (testFormatting{TabSize: 8, UseTabs: true}) {
+			t.Errorf("%v: expected the pushed settings, got %+v", settings, value)
+		}
+	}
+}
+
+func TestConfigurationManagerStaleFetch(t *testing.T) {
+	ctx := context.Background()
+
+	client := &configurationClient{settings: map[string]interface{}{"tabSize": 2}}
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var once sync.Once
+	conn := &recordingConn{
+		respond: func(method string, params interface{}) (interface{}, error) {
+			response, err := client.respond(method, params)
+
+			// The first request is held back until the configuration has
+			// changed.
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+
+			return response, err
+		},
+	}
+
+	manager := newTestConfigurationManager(t, conn, true)
+
+	done := make(chan error)
+	go func() {
+		_, err := manager.Get(ctx, "go.formatting", "")
+		done <- err
+	}()
+
+	<-started
+	client.set(map[string]interface{}{"tabSize": 8})
+	if err := manager.DidChangeConfiguration(ctx, &DidChangeConfigurationParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := manager.Get(ctx, "go.formatting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value.(testFormatting).TabSize != 8 {
+		t.Errorf("expected the value fetched before the change not to be cached, got %+v", value)
+	}
+}
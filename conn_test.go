@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// recordedMessage is a request or notification sent over a recordingConn.
+type recordedMessage struct {
+	method string
+	params json.RawMessage
+}
+
+// recordingConn is a Conn that records the messages sent over it. Requests
+// are answered by respond if it's set, and with a null result otherwise.
+type recordingConn struct {
+	respond func(method string, params interface{}) (interface{}, error)
+
+	mu       sync.Mutex
+	messages []recordedMessage
+}
+
+func (conn *recordingConn) Call(ctx context.Context, method string, params, result interface{}) error {
+	if err := conn.record(method, params); err != nil || conn.respond == nil {
+		return err
+	}
+
+	response, err := conn.respond(method, params)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(encoded, result)
+}
+
+func (conn *recordingConn) Notify(ctx context.Context, method string, params interface{}) error {
+	return conn.record(method, params)
+}
+
+func (conn *recordingConn) record(method string, params interface{}) error {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.messages = append(conn.messages, recordedMessage{method: method, params: encoded})
+	return nil
+}
+
+// sent returns the messages sent for a method.
+func (conn *recordingConn) sent(method string) []json.RawMessage {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	var params []json.RawMessage
+	for _, message := range conn.messages {
+		if message.method == method {
+			params = append(params, message.params)
+		}
+	}
+
+	return params
+}
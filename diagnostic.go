@@ -87,7 +87,7 @@ type Diagnostic struct {
 
 	// A human-readable string describing the source of this diagnostic, e.g.
 	// 'typescript' or 'super lint'.
-	Source string `json:"omitempty"`
+	Source string `json:"source,omitempty"`
 
 	// The diagnostic's message.
 	Message string `json:"message"`
@@ -97,7 +97,7 @@ type Diagnostic struct {
 
 	// An array of related diagnostic information, e.g. when symbol-names within
 	// a scope collide all definitions can be marked via this property.
-	RelatedInformation []DiagnosticRelatedInformation `json:"diagnosticRelatedInformation,omitempty"`
+	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
 
 	// A data entry field that is preserved between a
 	// `textDocument/publishDiagnostics` notification and
@@ -0,0 +1,370 @@
+package lsp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiagnosticsManager collects the diagnostics of several sources, like a
+// parser and a linter, and publishes them to the client. Since
+// `textDocument/publishDiagnostics` always replaces all diagnostics of a
+// document, the manager keeps one set of diagnostics per source and document
+// and publishes them merged.
+//
+// Publishing is debounced, so that sources reporting in quick succession
+// result in a single notification. Diagnostics computed for an older version
+// of a document than the latest one known to the manager are dropped, and
+// published diagnostics are tagged with the version of the document. Before
+// publishing, diagnostics are stripped of the properties the client doesn't
+// support.
+//
+// A DiagnosticsManager is safe for concurrent use.
+type DiagnosticsManager struct {
+	// An optional function that's called when publishing diagnostics fails.
+	ErrorHandler func(err error)
+
+	conn         Conn
+	debounce     time.Duration
+	capabilities PublishDiagnosticsClientCapabilities
+
+	mu        sync.Mutex
+	documents map[DocumentURI]*diagnosticsDocument
+	openOnly  map[string]bool
+	closed    bool
+
+	// Held while publishing, so that notifications can't overtake each
+	// other.
+	publishing sync.Mutex
+}
+
+// diagnosticsDocument holds the diagnostics of a single document.
+type diagnosticsDocument struct {
+	open    bool
+	version int
+	sets    map[string]diagnosticsSet
+	timer   *time.Timer
+}
+
+// diagnosticsSet holds the diagnostics a source reported for a document, along
+// with the version of the document they were computed for.
+type diagnosticsSet struct {
+	version     int
+	diagnostics []Diagnostic
+}
+
+// NewDiagnosticsManager instantiates a DiagnosticsManager that publishes over
+// conn, waiting for debounce after the last change to a document before
+// publishing its diagnostics. A debounce of zero publishes immediately.
+func NewDiagnosticsManager(conn Conn, capabilities *ClientCapabilities, debounce time.Duration) *DiagnosticsManager {
+	manager := &DiagnosticsManager{
+		conn:      conn,
+		debounce:  debounce,
+		documents: map[DocumentURI]*diagnosticsDocument{},
+		openOnly:  map[string]bool{},
+	}
+
+	if capabilities != nil && capabilities.TextDocument != nil && capabilities.TextDocument.PublishDiagnostics != nil {
+		manager.capabilities = *capabilities.TextDocument.PublishDiagnostics
+	}
+
+	return manager
+}
+
+// RegisterSource declares how the diagnostics of a source are handled. If
+// openOnly is set, the source only analyzes open documents, and its
+// diagnostics are cleared when a document is closed. Sources that aren't
+// registered keep their diagnostics after a document has been closed.
+func (manager *DiagnosticsManager) RegisterSource(source string, openOnly bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.openOnly[source] = openOnly
+}
+
+// DidOpen records that a document has been opened with the given version.
+func (manager *DiagnosticsManager) DidOpen(uri DocumentURI, version int) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	document := manager.document(uri)
+	document.open = true
+	document.version = version
+}
+
+// DidChange records the new version of a document. Diagnostics computed for
+// an older version are dropped from now on.
+func (manager *DiagnosticsManager) DidChange(uri DocumentURI, version int) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.document(uri).version = version
+}
+
+// DidClose records that a document has been closed, and clears the
+// diagnostics of all sources that only analyze open documents.
+func (manager *DiagnosticsManager) DidClose(uri DocumentURI) {
+	manager.mu.Lock()
+
+	document, ok := manager.documents[uri]
+	if !ok {
+		manager.mu.Unlock()
+		return
+	}
+
+	document.open = false
+	document.version = 0
+
+	changed := false
+	for source := range document.sets {
+		if manager.openOnly[source] {
+			delete(document.sets, source)
+			changed = true
+		}
+	}
+
+	flush := false
+	if changed {
+		flush = manager.schedule(uri, document)
+	} else {
+		manager.forget(uri, document)
+	}
+
+	manager.mu.Unlock()
+
+	if flush {
+		manager.flush(uri)
+	}
+}
+
+// Set replaces the diagnostics a source reported for a document. The version
+// is the version of the document the diagnostics were computed for, or zero if
+// they weren't computed from an open document. Diagnostics for a version older
+// than the latest known one are dropped, and so are the diagnostics of sources
+// that only analyze open documents if the document isn't open. The source is
+// filled in for diagnostics that don't have one.
+func (manager *DiagnosticsManager) Set(source string, uri DocumentURI, version int, diagnostics []Diagnostic) {
+	manager.mu.Lock()
+
+	if manager.closed {
+		manager.mu.Unlock()
+		return
+	}
+
+	if existing, ok := manager.documents[uri]; manager.openOnly[source] && (!ok || !existing.open) {
+		manager.mu.Unlock()
+		return
+	}
+
+	document := manager.document(uri)
+	if version != 0 && version < document.version {
+		manager.mu.Unlock()
+		return
+	}
+
+	if version > document.version {
+		document.version = version
+	}
+
+	set := make([]Diagnostic, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		if diagnostic.Source == "" {
+			diagnostic.Source = source
+		}
+
+		set[i] = diagnostic
+	}
+
+	document.sets[source] = diagnosticsSet{version: version, diagnostics: set}
+	flush := manager.schedule(uri, document)
+	manager.mu.Unlock()
+
+	if flush {
+		manager.flush(uri)
+	}
+}
+
+// Clear removes the diagnostics a source reported for a document.
+func (manager *DiagnosticsManager) Clear(source string, uri DocumentURI) {
+	manager.mu.Lock()
+
+	document, ok := manager.documents[uri]
+	if !ok {
+		manager.mu.Unlock()
+		return
+	}
+
+	if _, ok := document.sets[source]; !ok {
+		manager.mu.Unlock()
+		return
+	}
+
+	delete(document.sets, source)
+	flush := manager.schedule(uri, document)
+	manager.mu.Unlock()
+
+	if flush {
+		manager.flush(uri)
+	}
+}
+
+// Diagnostics returns the merged diagnostics of a document, as they would be
+// published.
+func (manager *DiagnosticsManager) Diagnostics(uri DocumentURI) []Diagnostic {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	document, ok := manager.documents[uri]
+	if !ok {
+		return []Diagnostic{}
+	}
+
+	return manager.params(uri, document).Diagnostics
+}
+
+// Close stops all pending publishes. Diagnostics set afterwards are ignored.
+func (manager *DiagnosticsManager) Close() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.closed = true
+	for _, document := range manager.documents {
+		if document.timer != nil {
+			document.timer.Stop()
+		}
+	}
+}
+
+// document returns the state of a document, creating it if needed.
+func (manager *DiagnosticsManager) document(uri DocumentURI) *diagnosticsDocument {
+	document, ok := manager.documents[uri]
+	if !ok {
+		document = &diagnosticsDocument{sets: map[string]diagnosticsSet{}}
+		manager.documents[uri] = document
+	}
+
+	return document
+}
+
+// schedule publishes the diagnostics of a document after the debounce delay.
+// Without a delay, it returns true, and the caller has to call `flush` once it
+// released the lock. It has to be called with the lock held.
+func (manager *DiagnosticsManager) schedule(uri DocumentURI, document *diagnosticsDocument) bool {
+	if manager.debounce <= 0 {
+		return true
+	}
+
+	if document.timer != nil {
+		document.timer.Stop()
+	}
+
+	document.timer = time.AfterFunc(manager.debounce, func() {
+		manager.mu.Lock()
+		if manager.documents[uri] == document {
+			document.timer = nil
+		}
+		manager.mu.Unlock()
+
+		manager.flush(uri)
+	})
+
+	return false
+}
+
+// flush publishes the current diagnostics of a document. The parameters are
+// built while holding the publishing lock, so the last notification sent for
+// a document always reflects its latest state.
+func (manager *DiagnosticsManager) flush(uri DocumentURI) {
+	manager.publishing.Lock()
+	defer manager.publishing.Unlock()
+
+	manager.mu.Lock()
+	if manager.closed {
+		manager.mu.Unlock()
+		return
+	}
+
+	params := PublishDiagnosticsParams{URI: uri, Diagnostics: []Diagnostic{}}
+	if document, ok := manager.documents[uri]; ok {
+		params = manager.params(uri, document)
+		manager.forget(uri, document)
+	}
+	manager.mu.Unlock()
+
+	err := manager.conn.Notify(context.Background(), "textDocument/publishDiagnostics", params)
+	if err != nil && manager.ErrorHandler != nil {
+		manager.ErrorHandler(err)
+	}
+}
+
+// forget drops the state of a document that's closed and has no diagnostics
+// left. It has to be called with the lock held.
+func (manager *DiagnosticsManager) forget(uri DocumentURI, document *diagnosticsDocument) {
+	if !document.open && len(document.sets) == 0 && document.timer == nil {
+		delete(manager.documents, uri)
+	}
+}
+
+// params builds the notification parameters for a document. Sets computed for
+// an older version of the document than the latest one are left out, since
+// their positions may no longer be valid. It has to be called with the lock
+// held.
+func (manager *DiagnosticsManager) params(uri DocumentURI, document *diagnosticsDocument) PublishDiagnosticsParams {
+	sources := make([]string, 0, len(document.sets))
+	for source := range document.sets {
+		sources = append(sources, source)
+	}
+
+	sort.Strings(sources)
+
+	params := PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []Diagnostic{},
+	}
+
+	if manager.capabilities.VersionSupport && document.open {
+		params.Version = document.version
+	}
+
+	for _, source := range sources {
+		set := document.sets[source]
+		if set.version != 0 && set.version < document.version {
+			continue
+		}
+
+		for _, diagnostic := range set.diagnostics {
+			params.Diagnostics = append(params.Diagnostics, manager.adapt(diagnostic))
+		}
+	}
+
+	return params
+}
+
+// adapt strips the properties the client doesn't support from a diagnostic.
+func (manager *DiagnosticsManager) adapt(diagnostic Diagnostic) Diagnostic {
+	if !manager.capabilities.RelatedInformation {
+		diagnostic.RelatedInformation = nil
+	}
+
+	if !manager.capabilities.CodeDescriptionSupport {
+		diagnostic.CodeDescription = nil
+	}
+
+	if !manager.capabilities.DataSupport {
+		diagnostic.Data = nil
+	}
+
+	var tags []DiagnosticTag
+	for _, tag := range diagnostic.Tags {
+		for _, supported := range manager.capabilities.TagSupport.ValueSet {
+			if tag == supported {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+
+	diagnostic.Tags = tags
+	return diagnostic
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// lastPublished decodes the last diagnostics published over conn.
+func lastPublished(t *testing.T, conn *recordingConn) PublishDiagnosticsParams {
+	t.Helper()
+
+	sent := conn.sent("textDocument/publishDiagnostics")
+	if len(sent) == 0 {
+		t.Fatal("no diagnostics have been published")
+	}
+
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(sent[len(sent)-1], &params); err != nil {
+		t.Fatal(err)
+	}
+
+	return params
+}
+
+func TestDiagnosticsManagerStaleVersions(t *testing.T) {
+	conn := &recordingConn{}
+	capabilities := &ClientCapabilities{}
+	if err := json.Unmarshal([]byte(`{"textDocument":{"publishDiagnostics":{"versionSupport":true}}}`), capabilities); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewDiagnosticsManager(conn, capabilities, 0)
+	uri := DocumentURI("file:///a.go")
+
+	manager.DidOpen(uri, 3)
+	manager.Set("parser", uri, 3, []Diagnostic{{Message: "old"}})
+	manager.DidChange(uri, 4)
+	manager.Set("linter", uri, 4, []Diagnostic{{Message: "new"}})
+
+	params := lastPublished(t, conn)
+	if params.Version != 4 {
+		t.Errorf("expected version 4, got %d", params.Version)
+	}
+
+	if len(params.Diagnostics) != 1 || params.Diagnostics[0].Message != "new" {
+		t.Errorf("expected only the diagnostics of version 4, got %+v", params.Diagnostics)
+	}
+
+	manager.Set("parser", uri, 3, []Diagnostic{{Message: "late"}})
+	if got := manager.Diagnostics(uri); len(got) != 1 || got[0].Message != "new" {
+		t.Errorf("expected late diagnostics to be dropped, got %+v", got)
+	}
+}
+
+func TestDiagnosticsManagerClosedDocument(t *testing.T) {
+	conn := &recordingConn{}
+	manager := NewDiagnosticsManager(conn, nil, 0)
+	manager.RegisterSource("analyzer", true)
+
+	uri := DocumentURI("file:///a.go")
+
+	manager.DidOpen(uri, 1)
+	manager.Set("analyzer", uri, 1, []Diagnostic{{Message: "open"}})
+	manager.Set("build", uri, 0, []Diagnostic{{Message: "build"}})
+	manager.DidClose(uri)
+
+	if got := lastPublished(t, conn).Diagnostics; len(got) != 1 || got[0].Message != "build" {
+		t.Errorf("expected only the build diagnostics after closing, got %+v", got)
+	}
+
+	manager.Set("analyzer", uri, 2, []Diagnostic{{Message: "late"}})
+	if got := manager.Diagnostics(uri); len(got) != 1 || got[0].Message != "build" {
+		t.Errorf("expected late analyzer results to be ignored, got %+v", got)
+	}
+}
+
+func TestDiagnosticsManagerClear(t *testing.T) {
+	conn := &recordingConn{}
+	manager := NewDiagnosticsManager(conn, nil, 0)
+	manager.RegisterSource("analyzer", true)
+
+	manager.Clear("analyzer", "file:///unknown.go")
+	if len(conn.messages) != 0 {
+		t.Errorf("expected nothing to be published for an unknown document, got %d messages", len(conn.messages))
+	}
+
+	uri := DocumentURI("file:///a.go")
+
+	manager.DidOpen(uri, 1)
+	manager.Set("analyzer", uri, 1, []Diagnostic{{Message: "open"}})
+	manager.Set("build", uri, 0, []Diagnostic{{Message: "build"}})
+
+	manager.Clear("build", uri)
+	if got := lastPublished(t, conn).Diagnostics; len(got) != 1 || got[0].Message != "open" {
+		t.Errorf("expected only the analyzer diagnostics after clearing, got %+v", got)
+	}
+
+	manager.DidClose(uri)
+	published := len(conn.messages)
+
+	manager.Clear("analyzer", uri)
+	manager.Clear("build", uri)
+	if len(conn.messages) != published {
+		t.Errorf("expected nothing to be published after closing, got %d more messages", len(conn.messages)-published)
+	}
+}
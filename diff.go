@@ -0,0 +1,351 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DiffGranularity defines how fine-grained the edits computed by
+// `ComputeEdits` should be.
+type DiffGranularity int
+
+const (
+	// DiffLines produces edits that always replace whole lines. The resulting
+	// edits are cheap to compute and easy to read in an undo history.
+	DiffLines DiffGranularity = iota + 1
+
+	// DiffCharacters first computes a line diff, then refines every changed
+	// block of lines down to single characters. This keeps cursors and
+	// markers that are located on changed lines in place.
+	DiffCharacters
+)
+
+func (granularity DiffGranularity) String() string {
+	switch granularity {
+	case DiffLines:
+		return "lines"
+	case DiffCharacters:
+		return "characters"
+	}
+
+	return "<unknown>"
+}
+
+// maxCharacterDiffSize is the maximum number of runes a changed block of lines
+// may have on either side to still be refined at character level. Bigger
+// blocks are kept as whole-line edits, since they are most likely rewrites
+// anyway and the diff would be expensive to compute.
+const maxCharacterDiffSize = 10000
+
+// ComputeEdits computes a minimal set of text edits that transform oldText into
+// newText. The edits don't overlap, are sorted by their position in the
+// document and use positions relative to oldText, which makes the result
+// suitable to be returned from a `textDocument/formatting` or
+// `textDocument/rangeFormatting` handler as-is.
+//
+// Character offsets in the resulting positions are expressed in UTF-16 code
+// units, as required by the specification.
+func ComputeEdits(oldText, newText string, granularity DiffGranularity) []TextEdit {
+	edits := []TextEdit{}
+	if oldText == newText {
+		return edits
+	}
+
+	oldLines, oldOffsets := splitLines(oldText)
+	newLines, newOffsets := splitLines(newText)
+	index := newLineIndex(oldText)
+
+	for _, hunk := range diffStrings(oldLines, newLines) {
+		oldStart, oldEnd := oldOffsets[hunk.oldStart], oldOffsets[hunk.oldEnd]
+		newStart, newEnd := newOffsets[hunk.newStart], newOffsets[hunk.newEnd]
+
+		oldSegment := oldText[oldStart:oldEnd]
+		newSegment := newText[newStart:newEnd]
+
+		if granularity == DiffCharacters && refinable(oldSegment, newSegment) {
+			edits = append(edits, characterEdits(index, oldStart, oldSegment, newSegment)...)
+			continue
+		}
+
+		edits = append(edits, TextEdit{
+			Range: Range{
+				Start: index.position(oldStart),
+				End:   index.position(oldEnd),
+			},
+			NewText: newSegment,
+		})
+	}
+
+	return edits
+}
+
+// refinable reports whether a changed block is small enough to be diffed at
+// character level.
+func refinable(oldSegment, newSegment string) bool {
+	return utf8.RuneCountInString(oldSegment) <= maxCharacterDiffSize &&
+		utf8.RuneCountInString(newSegment) <= maxCharacterDiffSize
+}
+
+// characterEdits diffs two segments rune by rune. The positions of the
+// resulting edits are shifted by base, which is the byte offset of oldSegment
+// in the original document.
+func characterEdits(index *lineIndex, base int, oldSegment, newSegment string) []TextEdit {
+	oldRunes, oldOffsets := splitRunes(oldSegment)
+	newRunes, newOffsets := splitRunes(newSegment)
+
+	edits := []TextEdit{}
+	for _, hunk := range diffStrings(oldRunes, newRunes) {
+		start := base + oldOffsets[hunk.oldStart]
+		end := base + oldOffsets[hunk.oldEnd]
+
+		edits = append(edits, TextEdit{
+			Range: Range{
+				Start: index.position(start),
+				End:   index.position(end),
+			},
+			NewText: newSegment[newOffsets[hunk.newStart]:newOffsets[hunk.newEnd]],
+		})
+	}
+
+	return edits
+}
+
+// splitLines splits text into lines, keeping the line terminators, which are
+// the same as in `newLineIndex`. It also returns the byte offset at which
+// every line starts, followed by the length of the text, so that
+// offsets[i]:offsets[j] always addresses lines i to j.
+func splitLines(text string) ([]string, []int) {
+	lines := []string{}
+	offsets := []int{0}
+
+	for start := 0; start < len(text); {
+		end := strings.IndexAny(text[start:], "\r\n")
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start
+			end += lineBreakLength(text, end)
+		}
+
+		lines = append(lines, text[start:end])
+		offsets = append(offsets, end)
+		start = end
+	}
+
+	return lines, offsets
+}
+
+// splitRunes splits text into runes. A `\r\n` line terminator is kept as a
+// single element, so that no edit ends up between its two characters, which
+// would be a position past the end of the line. Offsets are built the same way
+// as in `splitLines`.
+func splitRunes(text string) ([]string, []int) {
+	runes := make([]string, 0, len(text))
+	offsets := make([]int, 0, len(text)+1)
+
+	for i := 0; i < len(text); {
+		size := lineBreakLength(text, i)
+		if size == 0 {
+			_, size = utf8.DecodeRuneInString(text[i:])
+		}
+
+		offsets = append(offsets, i)
+		runes = append(runes, text[i:i+size])
+		i += size
+	}
+
+	offsets = append(offsets, len(text))
+	return runes, offsets
+}
+
+// diffHunk denotes a block of changed elements. The elements between oldStart
+// and oldEnd have to be replaced by the elements between newStart and newEnd.
+type diffHunk struct {
+	oldStart, oldEnd int
+	newStart, newEnd int
+}
+
+// diffStrings computes the shortest edit script between a and b using Myers'
+// O(ND) algorithm and returns it as a list of hunks.
+func diffStrings(a, b []string) []diffHunk {
+	// Elements are interned so the hot loop only has to compare integers.
+	ids := map[string]int{}
+	intern := func(elements []string) []int {
+		result := make([]int, len(elements))
+		for i, element := range elements {
+			id, ok := ids[element]
+			if !ok {
+				id = len(ids)
+				ids[element] = id
+			}
+
+			result[i] = id
+		}
+
+		return result
+	}
+
+	return myers(intern(a), intern(b))
+}
+
+// myers is the actual implementation of the diff algorithm. It uses the
+// linear space variant, which recursively splits the sequences at the middle
+// snake of an optimal path, so that memory stays proportional to the length of
+// the sequences rather than to the number of differences.
+func myers(a, b []int) []diffHunk {
+	size := len(a) + len(b) + 3
+
+	differ := &differ{
+		a:        a,
+		b:        b,
+		removed:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+		forward:  make([]int, 2*size),
+		backward: make([]int, 2*size),
+		offset:   size,
+	}
+
+	differ.compare(0, len(a), 0, len(b))
+	return differ.hunks()
+}
+
+// differ holds the state of a diff computation.
+type differ struct {
+	a, b []int
+
+	// The elements of a that are removed and the elements of b that are
+	// inserted.
+	removed, inserted []bool
+
+	// The furthest reaching x coordinates of the forward and backward
+	// searches, indexed by diagonal plus offset. They are shared by all calls
+	// to `middleSnake`.
+	forward, backward []int
+	offset            int
+}
+
+// compare marks the differences between a[aLow:aHigh] and b[bLow:bHigh].
+func (differ *differ) compare(aLow, aHigh, bLow, bHigh int) {
+	for aLow < aHigh && bLow < bHigh && differ.a[aLow] == differ.b[bLow] {
+		aLow++
+		bLow++
+	}
+
+	for aLow < aHigh && bLow < bHigh && differ.a[aHigh-1] == differ.b[bHigh-1] {
+		aHigh--
+		bHigh--
+	}
+
+	switch {
+	case aLow == aHigh:
+		for j := bLow; j < bHigh; j++ {
+			differ.inserted[j] = true
+		}
+	case bLow == bHigh:
+		for i := aLow; i < aHigh; i++ {
+			differ.removed[i] = true
+		}
+	default:
+		// Both ranges differ in their first and last elements, so the edit
+		// distance is at least 2 and both halves are strictly smaller.
+		x, y, u, v := differ.middleSnake(aLow, aHigh, bLow, bHigh)
+		differ.compare(aLow, x, bLow, y)
+		differ.compare(u, aHigh, v, bHigh)
+	}
+}
+
+// middleSnake finds the middle snake of an optimal path between
+// a[aLow:aHigh] and b[bLow:bHigh] by searching from both ends at once. It
+// returns the start and end points of the snake.
+func (differ *differ) middleSnake(aLow, aHigh, bLow, bHigh int) (int, int, int, int) {
+	a, b := differ.a, differ.b
+	forward, backward, offset := differ.forward, differ.backward, differ.offset
+
+	n, m := aHigh-aLow, bHigh-bLow
+	delta := n - m
+	odd := delta%2 != 0
+
+	// The backward search runs on the reversed sequences, where the diagonal
+	// k of the forward search is the diagonal delta-k.
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	for d := 0; d <= (n+m+1)/2; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			startX, startY := x, x-k
+			y := startY
+			for x < n && y < m && a[aLow+x] == b[bLow+y] {
+				x++
+				y++
+			}
+
+			forward[offset+k] = x
+
+			reversed := delta - k
+			if odd && reversed >= -(d-1) && reversed <= d-1 && x+backward[offset+reversed] >= n {
+				return aLow + startX, bLow + startY, aLow + x, bLow + y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+
+			startX, startY := x, x-k
+			y := startY
+			for x < n && y < m && a[aHigh-1-x] == b[bHigh-1-y] {
+				x++
+				y++
+			}
+
+			backward[offset+k] = x
+
+			reversed := delta - k
+			if !odd && reversed >= -d && reversed <= d && x+forward[offset+reversed] >= n {
+				return aHigh - x, bHigh - y, aHigh - startX, bHigh - startY
+			}
+		}
+	}
+
+	// Unreachable, since the searches always meet.
+	return aLow, bLow, aLow, bLow
+}
+
+// hunks collects the marked differences into blocks of changed elements.
+func (differ *differ) hunks() []diffHunk {
+	hunks := []diffHunk{}
+
+	i, j := 0, 0
+	for i < len(differ.a) || j < len(differ.b) {
+		if i < len(differ.a) && j < len(differ.b) && !differ.removed[i] && !differ.inserted[j] {
+			i++
+			j++
+			continue
+		}
+
+		hunk := diffHunk{oldStart: i, newStart: j}
+		for i < len(differ.a) && differ.removed[i] {
+			i++
+		}
+
+		for j < len(differ.b) && differ.inserted[j] {
+			j++
+		}
+
+		hunk.oldEnd, hunk.newEnd = i, j
+		hunks = append(hunks, hunk)
+	}
+
+	return hunks
+}
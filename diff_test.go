@@ -0,0 +1,201 @@
+package lsp
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// randomText builds a text from a small alphabet of lines and characters, so
+// that random texts share a lot of elements.
+func randomText(random *rand.Rand) string {
+	lines := []string{"", "foo", "bar", "\tbaz", "qux😀", "héllo"}
+	terminators := []string{"\n", "\n", "\n", "\r\n", "\r"}
+
+	var builder strings.Builder
+	for i := random.Intn(12); i > 0; i-- {
+		builder.WriteString(lines[random.Intn(len(lines))])
+		if random.Intn(8) > 0 {
+			builder.WriteString(terminators[random.Intn(len(terminators))])
+		}
+	}
+
+	return builder.String()
+}
+
+func TestComputeEditsRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		oldText, newText := randomText(random), randomText(random)
+
+		for _, granularity := range []DiffGranularity{DiffLines, DiffCharacters} {
+			edits := ComputeEdits(oldText, newText, granularity)
+			checkEditPositions(t, oldText, edits)
+
+			result, err := ApplyTextEdits(oldText, edits)
+			if err != nil {
+				t.Fatalf("%v: %q -> %q: %v", granularity, oldText, newText, err)
+			}
+
+			if result != newText {
+				t.Fatalf("%v: %q -> %q: got %q", granularity, oldText, newText, result)
+			}
+		}
+	}
+}
+
+// checkEditPositions fails the test if an edit has a position past the end of
+// its line, which clients would clamp.
+func checkEditPositions(t *testing.T, text string, edits []TextEdit) {
+	t.Helper()
+
+	index := newLineIndex(text)
+	for _, edit := range edits {
+		for _, position := range []Position{edit.Range.Start, edit.Range.End} {
+			if index.position(index.offset(position)) != position {
+				t.Fatalf("%q: edit %+v has a position past the end of its line", text, edit)
+			}
+		}
+	}
+}
+
+func TestComputeEditsLineEndings(t *testing.T) {
+	tests := []struct {
+		oldText, newText string
+		edits            []TextEdit
+	}{
+		{
+			"a\r\nb\r\n", "a\nb\n",
+			[]TextEdit{
+				{Range: Range{Start: Position{Line: 0, Character: 1}, End: Position{Line: 1, Character: 0}}, NewText: "\n"},
+				{Range: Range{Start: Position{Line: 1, Character: 1}, End: Position{Line: 2, Character: 0}}, NewText: "\n"},
+			},
+		},
+		{
+			"a\rb\r", "a\r\nb\r\n",
+			[]TextEdit{
+				{Range: Range{Start: Position{Line: 0, Character: 1}, End: Position{Line: 1, Character: 0}}, NewText: "\r\n"},
+				{Range: Range{Start: Position{Line: 1, Character: 1}, End: Position{Line: 2, Character: 0}}, NewText: "\r\n"},
+			},
+		},
+		{
+			"a\r\nb", "a\r\nc",
+			[]TextEdit{
+				{Range: Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 1}}, NewText: "c"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		edits := ComputeEdits(test.oldText, test.newText, DiffCharacters)
+		if !reflect.DeepEqual(edits, test.edits) {
+			t.Errorf("%q -> %q: expected %+v, got %+v", test.oldText, test.newText, test.edits, edits)
+		}
+	}
+}
+
+func TestApplyTextEditsLineEndings(t *testing.T) {
+	edits := []TextEdit{
+		{Range: Range{Start: Position{Line: 0, Character: 5}, End: Position{Line: 0, Character: 5}}, NewText: "!"},
+		{Range: Range{Start: Position{Line: 1, Character: 5}, End: Position{Line: 1, Character: 5}}, NewText: "?"},
+	}
+
+	for _, terminator := range []string{"\n", "\r\n", "\r"} {
+		text := "a" + terminator + "b" + terminator + "c"
+		expected := "a!" + terminator + "b?" + terminator + "c"
+
+		result, err := ApplyTextEdits(text, edits)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	}
+}
+
+// lcsLength computes the length of the longest common subsequence of a and b
+// with the quadratic dynamic programming algorithm.
+func lcsLength(a, b []string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				current[j+1] = previous[j] + 1
+			case previous[j+1] > current[j]:
+				current[j+1] = previous[j+1]
+			default:
+				current[j+1] = current[j]
+			}
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func TestDiffStringsMinimal(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	alphabet := []string{"a", "b", "c"}
+
+	generate := func() []string {
+		elements := make([]string, random.Intn(30))
+		for i := range elements {
+			elements[i] = alphabet[random.Intn(len(alphabet))]
+		}
+
+		return elements
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := generate(), generate()
+
+		changed := 0
+		for _, hunk := range diffStrings(a, b) {
+			changed += hunk.oldEnd - hunk.oldStart + hunk.newEnd - hunk.newStart
+		}
+
+		if expected := len(a) + len(b) - 2*lcsLength(a, b); changed != expected {
+			t.Fatalf("%v -> %v: %d changed elements, expected %d", a, b, changed, expected)
+		}
+	}
+}
+
+func TestComputeEditsReindent(t *testing.T) {
+	var oldText, newText strings.Builder
+	for i := 0; i < 4000; i++ {
+		oldText.WriteString("\tline\n")
+		newText.WriteString("    line\n")
+	}
+
+	edits := ComputeEdits(oldText.String(), newText.String(), DiffLines)
+
+	result, err := ApplyTextEdits(oldText.String(), edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != newText.String() {
+		t.Fatal("reindented text doesn't round trip")
+	}
+}
+
+func BenchmarkComputeEditsReindent(b *testing.B) {
+	var oldText, newText strings.Builder
+	for i := 0; i < 4000; i++ {
+		oldText.WriteString("\tline " + string(rune('a'+i%26)) + "\n")
+		newText.WriteString("    line " + string(rune('a'+i%26)) + "\n")
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ComputeEdits(oldText.String(), newText.String(), DiffLines)
+	}
+}
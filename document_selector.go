@@ -0,0 +1,96 @@
+package lsp
+
+// Score reports how well a document matches the filter. The result is zero if
+// the document doesn't match. Otherwise, it's the highest score of the
+// properties set on the filter: an exact match of the language or the scheme
+// scores 10 and a wildcard (`*`) scores 5. A pattern scores 10 if it's equal
+// to the path of the document and 5 if it matches as a glob pattern. A filter
+// without any property set matches no document.
+func (filter DocumentFilter) Score(uri DocumentURI, languageID string) int {
+	score := 0
+
+	if filter.Language != "" {
+		switch filter.Language {
+		case languageID:
+			score = 10
+		case "*":
+			score = 5
+		default:
+			return 0
+		}
+	}
+
+	scheme, path, ok := documentSchemeAndPath(uri)
+	if !ok && (filter.Scheme != "" || filter.Pattern != "") {
+		return 0
+	}
+
+	if filter.Scheme != "" {
+		switch filter.Scheme {
+		case scheme:
+			if score < 10 {
+				score = 10
+			}
+		case "*":
+			if score < 5 {
+				score = 5
+			}
+		default:
+			return 0
+		}
+	}
+
+	if filter.Pattern != "" {
+		if filter.Pattern == path {
+			if score < 10 {
+				score = 10
+			}
+		} else {
+			glob, err := cachedGlob(filter.Pattern, false)
+			if err != nil || !glob.Match(path) {
+				return 0
+			}
+
+			if score < 5 {
+				score = 5
+			}
+		}
+	}
+
+	return score
+}
+
+// Matches reports whether a document matches the filter.
+func (filter DocumentFilter) Matches(uri DocumentURI, languageID string) bool {
+	return filter.Score(uri, languageID) > 0
+}
+
+// Score reports how well a document matches the selector. It's the highest
+// score of all filters in the selector, or zero if no filter matches. It can
+// be used to pick the best of several registrations that cover a document.
+func (selector DocumentSelector) Score(uri DocumentURI, languageID string) int {
+	score := 0
+	for _, filter := range selector {
+		if filterScore := filter.Score(uri, languageID); filterScore > score {
+			score = filterScore
+		}
+	}
+
+	return score
+}
+
+// Matches reports whether a document matches any filter of the selector.
+func (selector DocumentSelector) Matches(uri DocumentURI, languageID string) bool {
+	return selector.Score(uri, languageID) > 0
+}
+
+// documentSchemeAndPath splits a document URI into its scheme and its
+// unescaped path, which glob patterns are matched against.
+func documentSchemeAndPath(uri DocumentURI) (string, string, bool) {
+	parsed, err := ParseURI(string(uri))
+	if err != nil {
+		return "", "", false
+	}
+
+	return parsed.Scheme, parsed.Path, true
+}
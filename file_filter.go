@@ -0,0 +1,87 @@
+package lsp
+
+// Compile compiles the glob of the pattern, honoring its `IgnoreCase` option.
+// Every pattern is only compiled once, and the resulting glob is shared.
+func (pattern *FileOperationPattern) Compile() (*Glob, error) {
+	ignoreCase := pattern.Options != nil && pattern.Options.IgnoreCase
+	return cachedGlob(pattern.Glob, ignoreCase)
+}
+
+// Matches reports whether a file or folder matches the filter. isDir tells
+// whether the URI denotes a folder, which is needed for patterns that only
+// match files or folders. A filter without a pattern matches nothing.
+func (filter FileOperationFilter) Matches(uri DocumentURI, isDir bool) bool {
+	if filter.Pattern == nil {
+		return false
+	}
+
+	switch filter.Pattern.Matches {
+	case FOPKindFile:
+		if isDir {
+			return false
+		}
+	case FOPKindFolder:
+		if !isDir {
+			return false
+		}
+	}
+
+	scheme, path, ok := documentSchemeAndPath(uri)
+	if !ok || (filter.Scheme != "" && filter.Scheme != scheme) {
+		return false
+	}
+
+	glob, err := filter.Pattern.Compile()
+	if err != nil {
+		return false
+	}
+
+	return glob.Match(path)
+}
+
+// MatchFileOperationFilters reports whether a file or folder matches any of
+// the filters, e.g. the ones a server registered for `workspace/willRenameFiles`.
+func MatchFileOperationFilters(filters []FileOperationFilter, uri DocumentURI, isDir bool) bool {
+	for _, filter := range filters {
+		if filter.Matches(uri, isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches reports whether the watcher is interested in a file event, based on
+// its glob pattern and the kinds of events it watches.
+func (watcher FileSystemWatcher) Matches(event FileEvent) bool {
+	kind := watcher.Kind
+	if kind == 0 {
+		kind = WKCreate | WKChange | WKDelete
+	}
+
+	var eventKind WatchKind
+	switch event.Type {
+	case FCTCreated:
+		eventKind = WKCreate
+	case FCTChanged:
+		eventKind = WKChange
+	case FCTDeleted:
+		eventKind = WKDelete
+	}
+
+	if kind&eventKind == 0 {
+		return false
+	}
+
+	_, path, ok := documentSchemeAndPath(event.URI)
+	if !ok {
+		return false
+	}
+
+	glob, err := cachedGlob(watcher.GlobPattern, false)
+	if err != nil {
+		return false
+	}
+
+	return glob.Match(path)
+}
@@ -0,0 +1,198 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Glob is a compiled glob pattern, as used by `DocumentFilter`,
+// `FileSystemWatcher` and `FileOperationPattern`. The glob dialect used by the
+// protocol differs from the one of `path/filepath.Match` and supports the
+// following syntax:
+//
+//   - `*` matches zero or more characters in a path segment.
+//   - `?` matches one character in a path segment.
+//   - `**` matches any number of path segments, including none.
+//   - `{}` groups alternatives, e.g. `**/*.{ts,js}` matches all TypeScript and
+//     JavaScript files.
+//   - `[]` declares a range of characters to match in a path segment, e.g.
+//     `example.[0-9]` matches `example.0`, `example.1`, ...
+//   - `[!...]` negates a range of characters, e.g. `example.[!0-9]` matches
+//     `example.a`, but not `example.0`.
+type Glob struct {
+	pattern string
+	regexp  *regexp.Regexp
+}
+
+// CompileGlob compiles a glob pattern. If ignoreCase is set, the pattern
+// matches paths regardless of their casing.
+func CompileGlob(pattern string, ignoreCase bool) (*Glob, error) {
+	var builder strings.Builder
+	if ignoreCase {
+		builder.WriteString("(?i)")
+	}
+
+	builder.WriteString("^")
+
+	runes := []rune(pattern)
+	depth := 0
+
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '/':
+			// A trailing `/**` also matches the folder itself.
+			if string(runes[i:]) == "/**" {
+				builder.WriteString("(?:/.*)?")
+				i = len(runes)
+				continue
+			}
+
+			builder.WriteString("/")
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+					builder.WriteString("(?:.*/)?")
+				} else {
+					builder.WriteString(".*")
+				}
+
+				continue
+			}
+
+			builder.WriteString("[^/]*")
+		case '?':
+			builder.WriteString("[^/]")
+		case '{':
+			depth++
+			builder.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				builder.WriteString(regexp.QuoteMeta("}"))
+				continue
+			}
+
+			depth--
+			builder.WriteString(")")
+		case ',':
+			if depth == 0 {
+				builder.WriteString(",")
+				continue
+			}
+
+			builder.WriteString("|")
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+
+			if end == len(runes) || end == i+1 {
+				builder.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+
+			builder.WriteString("[")
+
+			set := runes[i+1 : end]
+			if set[0] == '!' && len(set) > 1 {
+				builder.WriteString("^/")
+				set = set[1:]
+			}
+
+			for _, c := range set {
+				if c == '\\' || c == '[' || c == '^' {
+					builder.WriteString(`\`)
+				}
+
+				builder.WriteRune(c)
+			}
+
+			builder.WriteString("]")
+			i = end
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("glob pattern %q has an unclosed brace", pattern)
+	}
+
+	builder.WriteString("$")
+
+	compiled, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+	}
+
+	return &Glob{pattern: pattern, regexp: compiled}, nil
+}
+
+// String returns the pattern the glob was compiled from.
+func (glob *Glob) String() string {
+	return glob.pattern
+}
+
+// Match reports whether a slash separated path matches the pattern. Patterns
+// that don't contain a slash are matched against the last segment of the path
+// only, so `*.go` matches every Go file, no matter where it's located.
+func (glob *Glob) Match(path string) bool {
+	if !strings.Contains(glob.pattern, "/") {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+
+	return glob.regexp.MatchString(path)
+}
+
+// maxCachedGlobs is the number of compiled globs kept by `cachedGlob`. Globs
+// come from registrations and selectors, so there are usually only a few.
+const maxCachedGlobs = 1024
+
+// globCacheKey identifies a compiled glob.
+type globCacheKey struct {
+	pattern    string
+	ignoreCase bool
+}
+
+// globCacheEntry is the result of compiling a glob.
+type globCacheEntry struct {
+	glob *Glob
+	err  error
+}
+
+var (
+	globCacheMu sync.Mutex
+	globCache   = map[globCacheKey]globCacheEntry{}
+)
+
+// cachedGlob compiles a glob pattern like `CompileGlob`, but compiles every
+// pattern only once, so that matchers that are called for every document or
+// file event don't have to compile their patterns again and again. Globs are
+// immutable, so they can be shared.
+func cachedGlob(pattern string, ignoreCase bool) (*Glob, error) {
+	key := globCacheKey{pattern: pattern, ignoreCase: ignoreCase}
+
+	globCacheMu.Lock()
+	entry, ok := globCache[key]
+	globCacheMu.Unlock()
+
+	if ok {
+		return entry.glob, entry.err
+	}
+
+	glob, err := CompileGlob(pattern, ignoreCase)
+
+	globCacheMu.Lock()
+	if len(globCache) >= maxCachedGlobs {
+		globCache = map[globCacheKey]globCacheEntry{}
+	}
+
+	globCache[key] = globCacheEntry{glob: glob, err: err}
+	globCacheMu.Unlock()
+
+	return glob, err
+}
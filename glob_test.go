@@ -0,0 +1,103 @@
+package lsp
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"**/*.go", "/src/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "/src/main.go.txt", false},
+		{"*.go", "/deep/folder/main.go", true},
+		{"/src/*.go", "/src/a/main.go", false},
+		{"/src/**", "/src", true},
+		{"/src/**", "/src/a/b.txt", true},
+		{"/src/**", "/srcs", false},
+		{"**/*.{ts,js}", "/a/b.js", true},
+		{"**/*.{ts,js}", "/a/b.css", false},
+		{"example.[0-9]", "example.5", true},
+		{"example.[!0-9]", "example.5", false},
+		{"example.[!0-9]", "example.a", true},
+		{"file?.txt", "/file1.txt", true},
+		{"file?.txt", "/file10.txt", false},
+	}
+
+	for _, test := range tests {
+		glob, err := CompileGlob(test.pattern, false)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+
+		if got := glob.Match(test.path); got != test.matches {
+			t.Errorf("%q matching %q: expected %v, got %v", test.pattern, test.path, test.matches, got)
+		}
+	}
+}
+
+func TestGlobIgnoreCase(t *testing.T) {
+	glob, err := CompileGlob("**/*.GO", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !glob.Match("/src/main.go") {
+		t.Error("expected a case insensitive match")
+	}
+}
+
+func TestCachedGlob(t *testing.T) {
+	first, err := cachedGlob("**/*.md", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := cachedGlob("**/*.md", false)
+	if first != second {
+		t.Error("expected the compiled glob to be reused")
+	}
+
+	if _, err := cachedGlob("{a,b", false); err == nil {
+		t.Error("expected an error for an invalid glob")
+	}
+}
+
+func TestFileMatchers(t *testing.T) {
+	filter := FileOperationFilter{
+		Scheme:  "file",
+		Pattern: &FileOperationPattern{Glob: "**/*.go", Matches: FOPKindFile},
+	}
+
+	if !filter.Matches("file:///src/main.go", false) {
+		t.Error("expected the filter to match a Go file")
+	}
+
+	if filter.Matches("file:///src/main.go", true) {
+		t.Error("expected the filter not to match a folder")
+	}
+
+	watcher := FileSystemWatcher{GlobPattern: "**/go.mod", Kind: WKChange}
+	if !watcher.Matches(FileEvent{URI: "file:///project/go.mod", Type: FCTChanged}) {
+		t.Error("expected the watcher to match a change")
+	}
+
+	if watcher.Matches(FileEvent{URI: "file:///project/go.mod", Type: FCTDeleted}) {
+		t.Error("expected the watcher not to match a deletion")
+	}
+
+	selector := DocumentSelector{
+		{Language: "go"},
+		{Scheme: "file", Pattern: "**/*_test.go"},
+	}
+
+	if score := selector.Score("file:///a/b_test.go", "go"); score != 10 {
+		t.Errorf("expected score 10, got %d", score)
+	}
+
+	if selector.Matches("untitled:Untitled-1", "python") {
+		t.Error("expected the selector not to match")
+	}
+}
@@ -0,0 +1,400 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// HandlerFunc handles a request or notification with the given raw
+// parameters. The result is ignored for notifications.
+type HandlerFunc func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// handlerCapabilityMethods maps methods that are part of a feature registered
+// under another method to that method.
+var handlerCapabilityMethods = map[string]string{
+	"textDocument/semanticTokens/full":       "textDocument/semanticTokens",
+	"textDocument/semanticTokens/full/delta": "textDocument/semanticTokens",
+	"textDocument/semanticTokens/range":      "textDocument/semanticTokens",
+	"completionItem/resolve":                 "textDocument/completion",
+	"codeAction/resolve":                     "textDocument/codeAction",
+	"codeLens/resolve":                       "textDocument/codeLens",
+	"documentLink/resolve":                   "textDocument/documentLink",
+	"textDocument/prepareRename":             "textDocument/rename",
+	"textDocument/colorPresentation":         "textDocument/documentColor",
+	"callHierarchy/incomingCalls":            "textDocument/prepareCallHierarchy",
+	"callHierarchy/outgoingCalls":            "textDocument/prepareCallHierarchy",
+}
+
+// capabilityFreeMethods holds the standard methods a server can handle that
+// don't need to be announced in the server capabilities.
+var capabilityFreeMethods = map[string]bool{
+	"initialize":                     true,
+	"initialized":                    true,
+	"shutdown":                       true,
+	"exit":                           true,
+	"$/cancelRequest":                true,
+	"$/setTrace":                     true,
+	"$/progress":                     true,
+	"window/workDoneProgress/cancel": true,
+}
+
+// standardMethodPrefixes are the prefixes of the methods defined by the
+// specification. Other methods are custom ones, which the registry accepts
+// without announcing them.
+var standardMethodPrefixes = []string{
+	"$/", "textDocument/", "workspace/", "window/", "client/", "notebookDocument/",
+	"completionItem/", "codeAction/", "codeLens/", "documentLink/", "callHierarchy/",
+	"typeHierarchy/", "inlayHint/",
+}
+
+// HandlerRegistry holds the handlers of a server along with the options of
+// the features they implement, and derives the server capabilities from them.
+// This way, the server never advertises a feature it doesn't handle, or
+// handles a feature it doesn't advertise.
+//
+// Options are passed along with the handler of the method they are registered
+// under, like `CompletionRegistrationOptions` for `textDocument/completion`.
+// The options of semantic tokens are passed along with any of the
+// `textDocument/semanticTokens/*` handlers.
+//
+// If `Registrations` is set, features registered dynamically through it are
+// left out of the server capabilities, so they aren't announced twice.
+type HandlerRegistry struct {
+	// An optional registration manager through which some of the features are
+	// registered dynamically.
+	Registrations *RegistrationManager
+
+	handlers map[string]HandlerFunc
+	options  map[string]interface{}
+}
+
+// NewHandlerRegistry instantiates an empty HandlerRegistry.
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers: map[string]HandlerFunc{},
+		options:  map[string]interface{}{},
+	}
+}
+
+// Handle registers the handler of a method, along with the registration
+// options of the feature it implements, which may be nil. It fails if the
+// method already has a handler, if the options aren't of the type the method
+// expects, or if the method is a standard one whose capability can't be
+// derived from the handler. Custom methods are accepted as they are.
+func (registry *HandlerRegistry) Handle(method string, handler HandlerFunc, options interface{}) error {
+	if handler == nil {
+		return fmt.Errorf("handler of %q is nil", method)
+	}
+
+	if _, ok := registry.handlers[method]; ok {
+		return fmt.Errorf("%q already has a handler", method)
+	}
+
+	capabilityMethod, dependent := handlerCapabilityMethods[method]
+
+	switch {
+	case dependent && capabilityMethod == "textDocument/semanticTokens":
+		if options != nil {
+			normalized, err := registrationOptionsOf(capabilityMethod, options)
+			if err != nil {
+				return err
+			}
+
+			if previous, ok := registry.options[capabilityMethod]; ok && !reflect.DeepEqual(previous, normalized) {
+				return fmt.Errorf("%q has been given options that differ from the other semantic tokens handlers", method)
+			}
+
+			registry.options[capabilityMethod] = normalized
+		}
+	case dependent:
+		if options != nil {
+			return fmt.Errorf("%q doesn't take options; pass them along with %q", method, capabilityMethod)
+		}
+	case method == "textDocument/semanticTokens":
+		return fmt.Errorf("%q is only used for registrations; handle the textDocument/semanticTokens/* requests instead", method)
+	case method == "workspace/didChangeWorkspaceFolders":
+		if options != nil {
+			return fmt.Errorf("%q doesn't take options", method)
+		}
+	default:
+		if _, ok := registrationMethods[method]; ok {
+			normalized, err := registrationOptionsOf(method, options)
+			if err != nil {
+				return err
+			}
+
+			registry.options[method] = normalized
+		} else if isStandardMethod(method) && !capabilityFreeMethods[method] {
+			return fmt.Errorf("%q can't be announced in the server capabilities", method)
+		} else if options != nil {
+			return fmt.Errorf("%q doesn't take options", method)
+		}
+	}
+
+	registry.handlers[method] = handler
+	return nil
+}
+
+// Handler returns the handler of a method.
+func (registry *HandlerRegistry) Handler(method string) (HandlerFunc, bool) {
+	handler, ok := registry.handlers[method]
+	return handler, ok
+}
+
+// Methods returns the methods that have a handler, sorted.
+func (registry *HandlerRegistry) Methods() []string {
+	methods := make([]string, 0, len(registry.handlers))
+	for method := range registry.handlers {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+// ServerCapabilities derives the server capabilities from the registered
+// handlers and options. It fails if they are inconsistent, like a completion
+// provider that claims to resolve items without a `completionItem/resolve`
+// handler, or semantic tokens without a legend. It's meant to be called at
+// startup, so that such mistakes surface right away, but after the features
+// that are registered dynamically have been registered.
+func (registry *HandlerRegistry) ServerCapabilities() (ServerCapabilities, error) {
+	var capabilities ServerCapabilities
+
+	for _, method := range registry.Methods() {
+		registration, ok := registrationMethods[method]
+		if !ok || registration.static == nil || registry.registeredDynamically(method) {
+			continue
+		}
+
+		registration.static(&capabilities, registry.options[method])
+	}
+
+	if registry.handles("workspace/didChangeWorkspaceFolders") {
+		// The change notifications are announced with the method as their
+		// registration ID, which allows to unregister them later on.
+		workspaceFoldersOf(&capabilities).Supported = true
+		workspaceFoldersOf(&capabilities).ChangeNotifications = "workspace/didChangeWorkspaceFolders"
+	}
+
+	if registry.handlesSemanticTokens() && !registry.registeredDynamically("textDocument/semanticTokens") {
+		options, ok := registry.options["textDocument/semanticTokens"]
+		if !ok {
+			options = &SemanticTokensRegistrationOptions{}
+		}
+
+		registrationMethods["textDocument/semanticTokens"].static(&capabilities, options)
+	}
+
+	if problems := registry.validate(&capabilities); len(problems) > 0 {
+		return ServerCapabilities{}, fmt.Errorf("inconsistent server capabilities: %s", strings.Join(problems, "; "))
+	}
+
+	return capabilities, nil
+}
+
+// handlesSemanticTokens reports whether any semantic tokens method has a
+// handler.
+func (registry *HandlerRegistry) handlesSemanticTokens() bool {
+	for method, capabilityMethod := range handlerCapabilityMethods {
+		if capabilityMethod == "textDocument/semanticTokens" && registry.handles(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isStandardMethod reports whether a method is defined by the specification,
+// based on its prefix.
+func isStandardMethod(method string) bool {
+	for _, prefix := range standardMethodPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// workspaceFoldersOf returns the workspace folder capabilities of the server,
+// creating the workspace capabilities if needed.
+func workspaceFoldersOf(capabilities *ServerCapabilities) *WorkspaceFoldersServerCapabilities {
+	folders := workspaceCapabilitiesOf(capabilities).FieldByName("WorkspaceFolders")
+	return folders.Addr().Interface().(*WorkspaceFoldersServerCapabilities)
+}
+
+// registeredDynamically reports whether a method has been registered
+// dynamically through the registration manager.
+func (registry *HandlerRegistry) registeredDynamically(method string) bool {
+	return registry.Registrations != nil && registry.Registrations.isRegisteredDynamically(method)
+}
+
+// handles reports whether a method has a handler.
+func (registry *HandlerRegistry) handles(method string) bool {
+	_, ok := registry.handlers[method]
+	return ok
+}
+
+// validate returns the inconsistencies between the handlers and the derived
+// capabilities.
+func (registry *HandlerRegistry) validate(capabilities *ServerCapabilities) []string {
+	var problems []string
+
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Both sides of a flag that announces an additional method have to
+	// agree.
+	requireMethod := func(flag bool, description string, method string) {
+		if flag && !registry.handles(method) {
+			report("%s, but %q has no handler", description, method)
+		} else if !flag && registry.handles(method) {
+			report("%q has a handler, but isn't announced", method)
+		}
+	}
+
+	for _, method := range registry.Methods() {
+		capabilityMethod, ok := handlerCapabilityMethods[method]
+		if ok && capabilityMethod != "textDocument/semanticTokens" && !registry.handles(capabilityMethod) {
+			report("%q has a handler, but %q hasn't", method, capabilityMethod)
+		}
+	}
+
+	if sync := capabilities.TextDocumentSync; sync != nil {
+		if registry.handles("textDocument/didOpen") != registry.handles("textDocument/didClose") {
+			report("textDocument/didOpen and textDocument/didClose have to be handled together")
+		}
+
+		if registry.handles("textDocument/didChange") && sync.Change == TDSyncKindNone {
+			report("textDocument/didChange has a handler, but its sync kind is none")
+		}
+	}
+
+	if completion := capabilities.CompletionProvider; completion != nil {
+		requireMethod(completion.ResolveProvider, "the completion provider resolves items", "completionItem/resolve")
+		problems = append(problems, checkCharacters("completion trigger character", completion.TriggerCharacters)...)
+		problems = append(problems, checkCharacters("completion commit character", completion.AllCommitCharacters)...)
+	}
+
+	if signatureHelp := capabilities.SignatureHelpProvider; signatureHelp != nil {
+		problems = append(problems, checkCharacters("signature help trigger character", signatureHelp.TriggerCharacters)...)
+		problems = append(problems, checkCharacters("signature help retrigger character", signatureHelp.RetriggerCharacters)...)
+	}
+
+	if onTypeFormatting := capabilities.DocumentOnTypeFormattingProvider; onTypeFormatting != nil {
+		if onTypeFormatting.FirstTriggerCharacter == "" {
+			report("on type formatting has no first trigger character")
+		}
+
+		problems = append(problems, checkCharacters("on type formatting trigger character", onTypeFormatting.MoreTriggerCharacter)...)
+	}
+
+	if codeAction := capabilities.CodeActionProvider; codeAction != nil {
+		requireMethod(codeAction.ResolveProvider, "the code action provider resolves actions", "codeAction/resolve")
+	}
+
+	if codeLens := capabilities.CodeLensProvider; codeLens != nil {
+		requireMethod(codeLens.ResolveProvider, "the code lens provider resolves lenses", "codeLens/resolve")
+	}
+
+	if documentLink := capabilities.DocumentLinkProvider; documentLink != nil {
+		requireMethod(documentLink.ResolveProvider, "the document link provider resolves links", "documentLink/resolve")
+	}
+
+	if rename := capabilities.RenameProvider; rename != nil {
+		requireMethod(rename.PrepareProvider, "the rename provider prepares renames", "textDocument/prepareRename")
+	}
+
+	if capabilities.ColorProvider != nil && !registry.handles("textDocument/colorPresentation") {
+		report("the color provider is announced, but %q has no handler", "textDocument/colorPresentation")
+	}
+
+	if capabilities.CallHierarchyProvider != nil {
+		for _, method := range []string{"callHierarchy/incomingCalls", "callHierarchy/outgoingCalls"} {
+			if !registry.handles(method) {
+				report("the call hierarchy provider is announced, but %q has no handler", method)
+			}
+		}
+	}
+
+	if semanticTokens := capabilities.SemanticTokensProvider; semanticTokens != nil {
+		if semanticTokens.Legend == nil || len(semanticTokens.Legend.TokenTypes) == 0 {
+			report("semantic tokens have no legend")
+		}
+
+		full := semanticTokens.Full != nil
+		requireMethod(full, "semantic tokens are provided for full documents", "textDocument/semanticTokens/full")
+		requireMethod(full && semanticTokens.Full.Delta, "semantic tokens are provided as deltas", "textDocument/semanticTokens/full/delta")
+		requireMethod(semanticTokens.Range, "semantic tokens are provided for ranges", "textDocument/semanticTokens/range")
+	}
+
+	if executeCommand := capabilities.ExecuteCommandProvider; executeCommand != nil {
+		if len(executeCommand.Commands) == 0 {
+			report("workspace/executeCommand has a handler, but no commands")
+		}
+
+		seen := map[string]bool{}
+		for _, command := range executeCommand.Commands {
+			if command == "" {
+				report("workspace/executeCommand has an empty command")
+			} else if seen[command] {
+				report("workspace/executeCommand has the command %q more than once", command)
+			}
+
+			seen[command] = true
+		}
+	}
+
+	for _, method := range []string{
+		"workspace/didCreateFiles", "workspace/willCreateFiles",
+		"workspace/didRenameFiles", "workspace/willRenameFiles",
+		"workspace/didDeleteFiles", "workspace/willDeleteFiles",
+	} {
+		if !registry.handles(method) {
+			continue
+		}
+
+		filters := registry.options[method].(*FileOperationRegistrationOptions).Filters
+		if len(filters) == 0 {
+			report("%q has a handler, but no file operation filters", method)
+		}
+
+		for _, filter := range filters {
+			if filter.Pattern == nil {
+				report("%q has a file operation filter without a pattern", method)
+				continue
+			}
+
+			if _, err := filter.Pattern.Compile(); err != nil {
+				report("%q has an invalid file operation pattern: %v", method, err)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkCharacters returns problems with a list of trigger or commit
+// characters, which have to be non-empty and unique.
+func checkCharacters(description string, characters []string) []string {
+	var problems []string
+
+	seen := map[string]bool{}
+	for _, character := range characters {
+		if character == "" {
+			problems = append(problems, fmt.Sprintf("empty %s", description))
+		} else if seen[character] {
+			problems = append(problems, fmt.Sprintf("duplicate %s %q", description, character))
+		}
+
+		seen[character] = true
+	}
+
+	return problems
+}
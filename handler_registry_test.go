@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func nopHandler(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+func TestHandlerRegistryWorkspaceFolders(t *testing.T) {
+	registry := NewHandlerRegistry()
+	if err := registry.Handle("workspace/didChangeWorkspaceFolders", nopHandler, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities, err := registry.ServerCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if capabilities.Workspace == nil {
+		t.Fatal("workspace capabilities haven't been announced")
+	}
+
+	folders := capabilities.Workspace.WorkspaceFolders
+	if !folders.Supported || folders.ChangeNotifications == "" {
+		t.Errorf("workspace folder change notifications haven't been announced: %+v", folders)
+	}
+}
+
+func TestHandlerRegistryRejectedMethods(t *testing.T) {
+	methods := []string{
+		"textDocument/semanticTokens",
+		"textDocument/publishDiagnostics",
+		"workspace/unknown",
+		"$/unknown",
+	}
+
+	for _, method := range methods {
+		if err := NewHandlerRegistry().Handle(method, nopHandler, nil); err == nil {
+			t.Errorf("handler of %q has been accepted", method)
+		}
+	}
+}
+
+func TestHandlerRegistryAcceptedMethods(t *testing.T) {
+	registry := NewHandlerRegistry()
+
+	methods := []string{"initialize", "shutdown", "$/cancelRequest", "custom/reload", "textDocument/semanticTokens/full"}
+	for _, method := range methods {
+		if err := registry.Handle(method, nopHandler, nil); err != nil {
+			t.Errorf("handler of %q has been rejected: %v", method, err)
+		}
+	}
+
+	if err := registry.Handle("custom/options", nopHandler, &HoverRegistrationOptions{}); err == nil {
+		t.Error("options of a custom method have been accepted")
+	}
+
+	if _, err := registry.ServerCapabilities(); err == nil {
+		t.Error("semantic tokens without a legend have been accepted")
+	}
+}
+
+func TestHandlerRegistryDynamicRegistrations(t *testing.T) {
+	ctx := context.Background()
+
+	manager := newTestRegistrationManager(t, &recordingConn{})
+	registry := NewHandlerRegistry()
+	registry.Registrations = manager
+
+	for _, method := range []string{"textDocument/completion", "textDocument/hover", "textDocument/definition"} {
+		if err := registry.Handle(method, nopHandler, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := manager.Register(ctx, method, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	capabilities, err := registry.ServerCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if capabilities.CompletionProvider != nil || capabilities.HoverProvider != nil {
+		t.Errorf("features registered dynamically have been announced: %+v", capabilities)
+	}
+
+	if capabilities.DefinitionProvider == nil {
+		t.Error("feature registered statically hasn't been announced")
+	}
+}
@@ -56,14 +56,22 @@ type InitializeParams struct {
 	// @since 3.16.0
 	Locale string `json:"locale,omitempty"`
 
-	// The rootUri of the workspace.
+	// The rootPath of the workspace. Is null if no folder is open.
+	//
+	// Deprecated: use `RootURI` or, preferably, `WorkspaceFolders` instead.
+	RootPath string `json:"rootPath,omitempty"`
+
+	// The rootUri of the workspace. Is null if no folder is open. If both
+	// `rootPath` and `rootUri` are set, `rootUri` wins.
+	//
+	// Deprecated: use `WorkspaceFolders` instead.
 	RootURI DocumentURI `json:"rootUri,omitempty"`
 
 	// User provided initialization options.
 	InitializationOptions interface{} `json:"initializationOptions"`
 
 	// The capabilities provided by the client (editor or tool).
-	// Capabilities ClientCapabilities `json:"capabilities"`
+	Capabilities ClientCapabilities `json:"capabilities"`
 
 	// The initial trace setting. If omitted trace is disabled ('off').
 	Trace TraceType `json:"trace,omitempty"`
@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecodeVSCodeInitializeParams(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/vscode_initialize.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var params InitializeParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities := &params.Capabilities
+
+	if edit := capabilities.WorkspaceEditCapabilities(); edit == nil || edit.FailureHandling != FHKTextOnlyTransactional {
+		t.Errorf("expected failure handling %q, got %+v", FHKTextOnlyTransactional, edit)
+	}
+
+	checks := map[string]bool{
+		"SupportsApplyEdit":           capabilities.SupportsApplyEdit(),
+		"SupportsDocumentChanges":     capabilities.SupportsDocumentChanges(),
+		"SupportsConfiguration":       capabilities.SupportsConfiguration(),
+		"SupportsWorkspaceFolders":    capabilities.SupportsWorkspaceFolders(),
+		"SupportsWorkDoneProgress":    capabilities.SupportsWorkDoneProgress(),
+		"SupportsShowDocument":        capabilities.SupportsShowDocument(),
+		"SupportsSnippets":            capabilities.SupportsSnippets(),
+		"SupportsMarkdownHover":       capabilities.SupportsMarkdownHover(),
+		"SupportsHierarchicalSymbols": capabilities.SupportsHierarchicalSymbols(),
+		"SupportsCodeActionLiterals":  capabilities.SupportsCodeActionLiterals(),
+		"SupportsPrepareRename":       capabilities.SupportsPrepareRename(),
+		"SupportsResourceOperation":   capabilities.SupportsResourceOperation(ROKRename),
+		"SupportsDynamicRegistration": capabilities.SupportsDynamicRegistration("workspace/didChangeWatchedFiles"),
+	}
+
+	for name, supported := range checks {
+		if !supported {
+			t.Errorf("%s: expected true", name)
+		}
+	}
+
+	if len(params.WorkspaceFolders) != 1 || params.WorkspaceFolders[0].Name != "project" {
+		t.Errorf("unexpected workspace folders %+v", params.WorkspaceFolders)
+	}
+}
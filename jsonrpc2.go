@@ -1,10 +1,24 @@
 package lsp
 
 import (
+	"context"
 	"encoding/json"
 	"strconv"
 )
 
+// Conn is a JSON-RPC 2.0 connection to the other side of the protocol, usually
+// the client. It's implemented by the transport the server runs on, and used
+// by the helpers of this package that need to send requests or notifications.
+type Conn interface {
+	// Call sends a request and waits for its response. The result of the
+	// response is decoded into result, which has to be a pointer. A response
+	// that contains an error is returned as an error.
+	Call(ctx context.Context, method string, params, result interface{}) error
+
+	// Notify sends a notification.
+	Notify(ctx context.Context, method string, params interface{}) error
+}
+
 // ID is a JSON-RPC 2.0 request ID. It can be either a string or a number.
 type ID struct {
 	AsInteger uint64
@@ -0,0 +1,401 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Output formats of common tools, to be used with `NewOutputParser`.
+const (
+	// OutputFormatGCC matches the diagnostics printed by GCC and Clang, like
+	// `main.c:3:5: error: unknown type name 'foo'`.
+	OutputFormatGCC = "%f:%l:%c: %t: %m"
+
+	// OutputFormatGo matches the diagnostics printed by the Go compiler and
+	// `go vet`, like `main.go:3:5: undefined: foo`.
+	OutputFormatGo = "%f:%l:%c: %m"
+
+	// OutputFormatUnix matches the unix formatter of ESLint and similar
+	// tools, like `main.js:3:5: 'foo' is not defined. [Error/no-undef]`.
+	OutputFormatUnix = "%f:%l:%c: %m [%t/%n]"
+
+	// OutputFormatLineOnly matches diagnostics that only have a line number,
+	// like `main.py:3: invalid syntax`.
+	OutputFormatLineOnly = "%f:%l: %m"
+)
+
+// ColumnUnit defines the unit the columns printed by a tool are measured in.
+type ColumnUnit int
+
+const (
+	// CUBytes means columns count bytes of UTF-8 encoded text.
+	CUBytes ColumnUnit = iota + 1
+
+	// CURunes means columns count Unicode code points.
+	CURunes
+
+	// CUUTF16 means columns count UTF-16 code units, like the protocol does.
+	CUUTF16
+)
+
+func (unit ColumnUnit) String() string {
+	switch unit {
+	case CUBytes:
+		return "bytes"
+	case CURunes:
+		return "runes"
+	case CUUTF16:
+		return "utf-16"
+	}
+
+	return "<unknown>"
+}
+
+// OutputPattern is a compiled output format. Formats are written in a dialect
+// of Vim's `errorformat` and match a single line of output:
+//
+//   - `%f` matches the file name.
+//   - `%l` and `%c` match the one-based line and column.
+//   - `%e` and `%k` match the one-based end line and end column.
+//   - `%t` matches the severity, like `error`, `warning` or `note`.
+//   - `%n` matches the code of the diagnostic.
+//   - `%m` matches the message.
+//   - `%%` matches a literal `%`.
+//
+// Every other character matches itself.
+type OutputPattern struct {
+	format string
+	regexp *regexp.Regexp
+	fields map[byte]int
+}
+
+// CompileOutputPattern compiles an output format.
+func CompileOutputPattern(format string) (*OutputPattern, error) {
+	pattern := &OutputPattern{
+		format: format,
+		fields: map[byte]int{},
+	}
+
+	var builder strings.Builder
+	builder.WriteString("^")
+
+	group := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			builder.WriteString(regexp.QuoteMeta(format[i : i+1]))
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return nil, fmt.Errorf("output format %q ends with a single %%", format)
+		}
+
+		field := format[i]
+
+		var expression string
+		switch field {
+		case '%':
+			builder.WriteString("%")
+			continue
+		case 'f':
+			expression = `(.+?)`
+		case 'l', 'c', 'e', 'k':
+			expression = `(\d+)`
+		case 't':
+			expression = `([A-Za-z][A-Za-z ]*?)`
+		case 'n':
+			expression = `(\S+?)`
+		case 'm':
+			expression = `(.*?)`
+		default:
+			return nil, fmt.Errorf("output format %q contains the unknown field %%%c", format, field)
+		}
+
+		if _, ok := pattern.fields[field]; ok {
+			return nil, fmt.Errorf("output format %q contains the field %%%c more than once", format, field)
+		}
+
+		group++
+		pattern.fields[field] = group
+		builder.WriteString(expression)
+	}
+
+	builder.WriteString("$")
+
+	if _, ok := pattern.fields['f']; !ok {
+		return nil, fmt.Errorf("output format %q doesn't contain a file name", format)
+	}
+
+	if _, ok := pattern.fields['l']; !ok {
+		return nil, fmt.Errorf("output format %q doesn't contain a line number", format)
+	}
+
+	compiled, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, err
+	}
+
+	pattern.regexp = compiled
+	return pattern, nil
+}
+
+// String returns the format the pattern was compiled from.
+func (pattern *OutputPattern) String() string {
+	return pattern.format
+}
+
+// outputMatch is a line of output matched by a pattern.
+type outputMatch struct {
+	file     string
+	line     int
+	column   int
+	endLine  int
+	endCol   int
+	severity string
+	code     string
+	message  string
+}
+
+// match matches a line of output against the pattern.
+func (pattern *OutputPattern) match(line string) (outputMatch, bool) {
+	groups := pattern.regexp.FindStringSubmatch(line)
+	if groups == nil {
+		return outputMatch{}, false
+	}
+
+	text := func(field byte) string {
+		if group, ok := pattern.fields[field]; ok {
+			return groups[group]
+		}
+
+		return ""
+	}
+
+	number := func(field byte) int {
+		value, _ := strconv.Atoi(text(field))
+		return value
+	}
+
+	return outputMatch{
+		file:     text('f'),
+		line:     number('l'),
+		column:   number('c'),
+		endLine:  number('e'),
+		endCol:   number('k'),
+		severity: text('t'),
+		code:     text('n'),
+		message:  strings.TrimSpace(text('m')),
+	}, true
+}
+
+// OutputParser turns the text output of a compiler or linter into
+// diagnostics. Every line of output is matched against the patterns in order,
+// and lines no pattern matches are ignored.
+type OutputParser struct {
+	// The patterns lines are matched against.
+	Patterns []*OutputPattern
+
+	// The source of the diagnostics, like `gcc`.
+	Source string
+
+	// The directory relative file names are resolved against, usually the
+	// working directory of the tool. If it's empty, lines with relative file
+	// names are ignored, since the document they refer to is unknown.
+	Directory string
+
+	// The style of the file names printed by the tool. Defaults to
+	// `NativePathStyle`.
+	PathStyle PathStyle
+
+	// The unit of the columns printed by the tool. Defaults to `CUBytes`.
+	ColumnUnit ColumnUnit
+
+	// The severity of diagnostics whose severity isn't printed. Defaults to
+	// `DSError`.
+	DefaultSeverity DiagnosticSeverity
+
+	// An optional function that returns the text of a document. It's needed
+	// to convert columns that aren't measured in UTF-16 code units, and to
+	// highlight the whole line when the tool doesn't print a column. Without
+	// it, columns are taken as they are.
+	ReadFile func(uri DocumentURI) (string, error)
+}
+
+// NewOutputParser instantiates an OutputParser with the given source and
+// output formats.
+func NewOutputParser(source string, formats ...string) (*OutputParser, error) {
+	parser := &OutputParser{Source: source}
+
+	for _, format := range formats {
+		pattern, err := CompileOutputPattern(format)
+		if err != nil {
+			return nil, err
+		}
+
+		parser.Patterns = append(parser.Patterns, pattern)
+	}
+
+	return parser, nil
+}
+
+// Parse parses the output of a tool and returns the diagnostics it contains,
+// grouped by document and sorted by URI.
+func (parser *OutputParser) Parse(output string) []PublishDiagnosticsParams {
+	documents := map[DocumentURI][]Diagnostic{}
+	texts := map[DocumentURI][]string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		for _, pattern := range parser.Patterns {
+			match, ok := pattern.match(line)
+			if !ok || match.line < 1 {
+				continue
+			}
+
+			uri, ok := parser.uriOf(match.file)
+			if !ok {
+				continue
+			}
+
+			lines, ok := texts[uri]
+			if !ok && parser.ReadFile != nil {
+				if text, err := parser.ReadFile(uri); err == nil {
+					lines = strings.Split(text, "\n")
+				}
+
+				texts[uri] = lines
+			}
+
+			documents[uri] = append(documents[uri], parser.diagnosticOf(match, lines))
+			break
+		}
+	}
+
+	uris := make([]string, 0, len(documents))
+	for uri := range documents {
+		uris = append(uris, string(uri))
+	}
+
+	sort.Strings(uris)
+
+	params := make([]PublishDiagnosticsParams, len(uris))
+	for i, uri := range uris {
+		params[i] = PublishDiagnosticsParams{
+			URI:         DocumentURI(uri),
+			Diagnostics: documents[DocumentURI(uri)],
+		}
+	}
+
+	return params
+}
+
+// diagnosticOf converts a matched line into a diagnostic. The lines of the
+// document are nil if its text isn't available.
+func (parser *OutputParser) diagnosticOf(match outputMatch, lines []string) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity: parser.severityOf(match.severity),
+		Code:     match.code,
+		Source:   parser.Source,
+		Message:  match.message,
+	}
+
+	start := Position{Line: match.line - 1}
+	end := start
+
+	if match.column > 0 {
+		start.Character = parser.characterOf(lines, start.Line, match.column)
+		end = start
+	} else if start.Line < len(lines) {
+		end.Character = utf16Length(strings.TrimSuffix(lines[start.Line], "\r"))
+	}
+
+	if match.endLine > 0 {
+		end = Position{Line: match.endLine - 1}
+	}
+
+	if match.endCol > 0 {
+		end.Character = parser.characterOf(lines, end.Line, match.endCol)
+	}
+
+	diagnostic.Range = Range{Start: start, End: end}
+	return diagnostic
+}
+
+// characterOf converts a one-based column into a zero-based character offset
+// in UTF-16 code units.
+func (parser *OutputParser) characterOf(lines []string, line int, column int) int {
+	offset := column - 1
+	if parser.ColumnUnit == CUUTF16 || line >= len(lines) {
+		return offset
+	}
+
+	text := strings.TrimSuffix(lines[line], "\r")
+
+	if parser.ColumnUnit == CURunes {
+		index := 0
+		for i := 0; i < offset && index < len(text); i++ {
+			_, size := utf8.DecodeRuneInString(text[index:])
+			index += size
+		}
+
+		return utf16Length(text[:index]) + offset - utf8.RuneCountInString(text[:index])
+	}
+
+	if offset > len(text) {
+		return utf16Length(text) + offset - len(text)
+	}
+
+	return utf16Length(text[:offset])
+}
+
+// severityOf maps a severity word printed by a tool to a diagnostic severity.
+func (parser *OutputParser) severityOf(word string) DiagnosticSeverity {
+	switch strings.ToLower(strings.TrimSpace(word)) {
+	case "error", "fatal", "fatal error", "e", "err", "failure":
+		return DSError
+	case "warning", "warn", "w":
+		return DSWarning
+	case "info", "information", "note", "i", "n":
+		return DSInformation
+	case "hint", "h", "help", "suggestion":
+		return DSHint
+	}
+
+	if parser.DefaultSeverity != 0 {
+		return parser.DefaultSeverity
+	}
+
+	return DSError
+}
+
+// uriOf converts a file name printed by the tool into a URI. It returns false
+// if the file name is relative and there is no absolute directory to resolve
+// it against.
+func (parser *OutputParser) uriOf(file string) (DocumentURI, bool) {
+	style := parser.PathStyle
+	if style == 0 {
+		style = NativePathStyle
+	}
+
+	if isAbsolutePath(file, style) {
+		uri, err := FromPath(file, style)
+		return uri, err == nil
+	}
+
+	directory, err := FromPath(parser.Directory, style)
+	if err != nil {
+		return "", false
+	}
+
+	if style == PSWindows {
+		file = strings.ReplaceAll(file, `\`, "/")
+	}
+
+	return directory.Join(strings.Split(file, "/")...), true
+}
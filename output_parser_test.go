@@ -0,0 +1,61 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutputParserFileNames(t *testing.T) {
+	output := "main.go:3:5: undefined: foo\n/abs/util.go:1:1: undefined: bar\n"
+
+	tests := []struct {
+		directory string
+		uris      []DocumentURI
+	}{
+		{"", []DocumentURI{"file:///abs/util.go"}},
+		{"/src", []DocumentURI{"file:///abs/util.go", "file:///src/main.go"}},
+	}
+
+	for _, test := range tests {
+		parser, err := NewOutputParser("go", OutputFormatGo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parser.Directory = test.directory
+		parser.PathStyle = PSPOSIX
+
+		uris := []DocumentURI{}
+		for _, params := range parser.Parse(output) {
+			uris = append(uris, params.URI)
+		}
+
+		if !reflect.DeepEqual(uris, test.uris) {
+			t.Errorf("%q: expected %v, got %v", test.directory, test.uris, uris)
+		}
+	}
+}
+
+func TestOutputParserDiagnostics(t *testing.T) {
+	parser, err := NewOutputParser("gcc", OutputFormatGCC, OutputFormatLineOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser.Directory = "/src"
+	parser.PathStyle = PSPOSIX
+
+	params := parser.Parse("main.c:3:5: warning: unused variable\r\nmain.c:4: missing semicolon\nnoise\n")
+	if len(params) != 1 || len(params[0].Diagnostics) != 2 {
+		t.Fatalf("expected two diagnostics for one document, got %+v", params)
+	}
+
+	first, second := params[0].Diagnostics[0], params[0].Diagnostics[1]
+	if first.Severity != DSWarning || first.Message != "unused variable" || first.Range.Start != (Position{Line: 2, Character: 4}) {
+		t.Errorf("unexpected diagnostic %+v", first)
+	}
+
+	if second.Severity != DSError || second.Message != "missing semicolon" || second.Range.Start.Line != 3 {
+		t.Errorf("unexpected diagnostic %+v", second)
+	}
+}
@@ -0,0 +1,215 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// PartialResultWriter streams the result of a request in batches. If the
+// client sent a partial result token along with the request, every batch is
+// sent to the client right away in a `$/progress` notification, and the final
+// response is empty, as the specification requires. Otherwise, batches are
+// merged into the final response.
+//
+// Batches are slices, like `[]Location` for `textDocument/references`, semantic
+// tokens or semantic token deltas. All batches of a writer have to be of the
+// same type, except that semantic tokens may start with a `SemanticTokens`
+// batch carrying the result ID, followed by `SemanticTokensPartialResult`
+// batches, as the specification describes. The same goes for deltas.
+//
+// A PartialResultWriter is safe for concurrent use.
+type PartialResultWriter struct {
+	conn  Conn
+	token ProgressToken
+
+	mu        sync.Mutex
+	batchType reflect.Type
+	result    interface{}
+}
+
+// NewPartialResultWriter instantiates a PartialResultWriter that streams over
+// conn, using the partial result token in params, if any.
+func NewPartialResultWriter(conn Conn, params PartialResultParams) *PartialResultWriter {
+	return &PartialResultWriter{
+		conn:  conn,
+		token: params.PartialResultToken,
+	}
+}
+
+// Streaming reports whether batches are sent to the client as they come in.
+func (writer *PartialResultWriter) Streaming() bool {
+	return writer.token != ""
+}
+
+// Send adds a batch to the result. When streaming, the batch is sent to the
+// client before Send returns.
+func (writer *PartialResultWriter) Send(ctx context.Context, batch interface{}) error {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	batchType := partialResultTypeOf(batch)
+	if writer.batchType != nil && batchType != writer.batchType {
+		return fmt.Errorf("partial result of type %T doesn't match the previous ones of type %v", batch, writer.batchType)
+	}
+
+	if !writer.Streaming() {
+		result, err := MergePartialResults(writer.result, batch)
+		if err != nil {
+			return err
+		}
+
+		writer.batchType = batchType
+		writer.result = result
+		return nil
+	}
+
+	if err := writer.conn.Notify(ctx, "$/progress", ProgressParams{Token: writer.token, Value: batch}); err != nil {
+		return err
+	}
+
+	if writer.batchType == nil {
+		writer.batchType = batchType
+		writer.result = emptyPartialResult(batch)
+	}
+
+	return nil
+}
+
+// Result returns the final response of the request. It's the merged batches,
+// or an empty result of the same type when streaming. If no batch has been
+// sent, the result is nil.
+func (writer *PartialResultWriter) Result() interface{} {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+
+	return writer.result
+}
+
+// MergePartialResults appends a partial result to the result merged so far,
+// which is nil for the first one. Slices are concatenated, and so are the data
+// of semantic tokens and the edits of semantic token deltas, which are merged
+// into `*SemanticTokens` and `*SemanticTokensDelta` respectively. A result ID
+// carried by a batch, usually the final response, replaces the previous one.
+func MergePartialResults(result, batch interface{}) (interface{}, error) {
+	if batch == nil {
+		return result, nil
+	}
+
+	if resultID, data, ok := semanticTokensOf(batch); ok {
+		switch merged := result.(type) {
+		case nil:
+			return &SemanticTokens{ResultID: resultID, Data: append([]uint{}, data...)}, nil
+		case *SemanticTokens:
+			if resultID != "" {
+				merged.ResultID = resultID
+			}
+
+			merged.Data = append(merged.Data, data...)
+			return merged, nil
+		}
+
+		return nil, fmt.Errorf("cannot merge partial result of type %T into %T", batch, result)
+	}
+
+	if resultID, edits, ok := semanticTokensDeltaOf(batch); ok {
+		switch merged := result.(type) {
+		case nil:
+			return &SemanticTokensDelta{ResultID: resultID, Edits: append([]SemanticTokensEdit{}, edits...)}, nil
+		case *SemanticTokensDelta:
+			if resultID != "" {
+				merged.ResultID = resultID
+			}
+
+			merged.Edits = append(merged.Edits, edits...)
+			return merged, nil
+		}
+
+		return nil, fmt.Errorf("cannot merge partial result of type %T into %T", batch, result)
+	}
+
+	value := reflect.ValueOf(batch)
+	if value.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("cannot merge partial result of type %T", batch)
+	}
+
+	if result == nil {
+		return reflect.AppendSlice(reflect.MakeSlice(value.Type(), 0, value.Len()), value).Interface(), nil
+	}
+
+	merged := reflect.ValueOf(result)
+	if merged.Type() != value.Type() {
+		return nil, fmt.Errorf("cannot merge partial result of type %T into %T", batch, result)
+	}
+
+	return reflect.AppendSlice(merged, value).Interface(), nil
+}
+
+// semanticTokensOf returns the result ID and data of semantic tokens, or false
+// if the value doesn't hold semantic tokens.
+func semanticTokensOf(value interface{}) (string, []uint, bool) {
+	switch tokens := value.(type) {
+	case SemanticTokens:
+		return tokens.ResultID, tokens.Data, true
+	case *SemanticTokens:
+		return tokens.ResultID, tokens.Data, true
+	case SemanticTokensPartialResult:
+		return "", tokens.Data, true
+	case *SemanticTokensPartialResult:
+		return "", tokens.Data, true
+	}
+
+	return "", nil, false
+}
+
+// semanticTokensDeltaOf returns the result ID and edits of a semantic tokens
+// delta, or false if the value doesn't hold one.
+func semanticTokensDeltaOf(value interface{}) (string, []SemanticTokensEdit, bool) {
+	switch delta := value.(type) {
+	case SemanticTokensDelta:
+		return delta.ResultID, delta.Edits, true
+	case *SemanticTokensDelta:
+		return delta.ResultID, delta.Edits, true
+	case SemanticTokensDeltaPartialResult:
+		return "", delta.Edits, true
+	case *SemanticTokensDeltaPartialResult:
+		return "", delta.Edits, true
+	}
+
+	return "", nil, false
+}
+
+// partialResultTypeOf returns the type batches are checked against. Semantic
+// tokens and their partial results belong to the same type, and so do
+// semantic token deltas and theirs.
+func partialResultTypeOf(batch interface{}) reflect.Type {
+	if _, _, ok := semanticTokensOf(batch); ok {
+		return reflect.TypeOf(SemanticTokens{})
+	}
+
+	if _, _, ok := semanticTokensDeltaOf(batch); ok {
+		return reflect.TypeOf(SemanticTokensDelta{})
+	}
+
+	return reflect.TypeOf(batch)
+}
+
+// emptyPartialResult returns the final response of a request whose result has
+// been streamed in batches like the given one.
+func emptyPartialResult(batch interface{}) interface{} {
+	if _, _, ok := semanticTokensOf(batch); ok {
+		return &SemanticTokens{Data: []uint{}}
+	}
+
+	if _, _, ok := semanticTokensDeltaOf(batch); ok {
+		return &SemanticTokensDelta{Edits: []SemanticTokensEdit{}}
+	}
+
+	value := reflect.ValueOf(batch)
+	if value.Kind() == reflect.Slice {
+		return reflect.MakeSlice(value.Type(), 0, 0).Interface()
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPartialResultWriterBuffered(t *testing.T) {
+	conn := &recordingConn{}
+	writer := NewPartialResultWriter(conn, PartialResultParams{})
+
+	for _, batch := range [][]Location{{{URI: "file:///a"}}, {{URI: "file:///b"}}} {
+		if err := writer.Send(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []Location{{URI: "file:///a"}, {URI: "file:///b"}}
+	if result := writer.Result(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	if len(conn.messages) != 0 {
+		t.Errorf("expected no notifications, got %d", len(conn.messages))
+	}
+
+	if err := writer.Send(context.Background(), []SymbolInformation{}); err == nil {
+		t.Error("expected batches of another type to be rejected")
+	}
+}
+
+func TestPartialResultWriterSemanticTokens(t *testing.T) {
+	conn := &recordingConn{}
+	writer := NewPartialResultWriter(conn, PartialResultParams{PartialResultToken: "token"})
+
+	batches := []interface{}{
+		&SemanticTokens{ResultID: "1", Data: []uint{0, 0, 3, 0, 0}},
+		SemanticTokensPartialResult{Data: []uint{1, 0, 3, 0, 0}},
+	}
+
+	for _, batch := range batches {
+		if err := writer.Send(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if sent := conn.sent("$/progress"); len(sent) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(sent))
+	}
+
+	result, ok := writer.Result().(*SemanticTokens)
+	if !ok || len(result.Data) != 0 {
+		t.Errorf("expected an empty final response, got %#v", writer.Result())
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(encoded) != `{"data":[]}` {
+		t.Errorf("unexpected final response %s", encoded)
+	}
+}
+
+func TestMergePartialResults(t *testing.T) {
+	var result interface{}
+
+	batches := []interface{}{
+		SemanticTokensDelta{ResultID: "1", Edits: []SemanticTokensEdit{{Start: 0}}},
+		&SemanticTokensDeltaPartialResult{Edits: []SemanticTokensEdit{{Start: 5}}},
+		SemanticTokensDelta{ResultID: "2"},
+	}
+
+	for _, batch := range batches {
+		merged, err := MergePartialResults(result, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result = merged
+	}
+
+	delta := result.(*SemanticTokensDelta)
+	if delta.ResultID != "2" || len(delta.Edits) != 2 || delta.Edits[1].Start != 5 {
+		t.Errorf("unexpected merged delta %+v", delta)
+	}
+
+	if _, err := MergePartialResults([]Location{}, []SymbolInformation{}); err == nil {
+		t.Error("expected slices of different types to be rejected")
+	}
+}
@@ -0,0 +1,261 @@
+package lsp
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the default minimum delay between two progress
+// reports sent for the same token.
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// ProgressManager starts work done progress reports and routes the
+// `window/workDoneProgress/cancel` notifications of the client to them.
+//
+// A ProgressManager is safe for concurrent use.
+type ProgressManager struct {
+	// The minimum delay between two reports sent for the same token. Reports
+	// sent in between are merged into the next one. Defaults to
+	// `DefaultProgressInterval`.
+	Interval time.Duration
+
+	// An optional function that's called when sending a report fails.
+	ErrorHandler func(err error)
+
+	conn      Conn
+	supported bool
+
+	mu      sync.Mutex
+	active  map[ProgressToken]*Progress
+	counter uint64
+}
+
+// NewProgressManager instantiates a ProgressManager that reports progress over
+// conn. The capabilities tell whether the client supports progress initiated
+// by the server.
+func NewProgressManager(conn Conn, capabilities *ClientCapabilities) *ProgressManager {
+	return &ProgressManager{
+		Interval:  DefaultProgressInterval,
+		conn:      conn,
+		supported: capabilities.SupportsWorkDoneProgress(),
+		active:    map[ProgressToken]*Progress{},
+	}
+}
+
+// Start begins reporting progress. The token is the `workDoneToken` the client
+// sent along with a request; if it's empty, a token is created with a
+// `window/workDoneProgress/create` request. If the client didn't provide a
+// token and doesn't support creating one, the returned progress doesn't report
+// anything.
+//
+// The kind of the begin payload is filled in, and its percentage is the one
+// later reports can't fall below.
+func (manager *ProgressManager) Start(ctx context.Context, token ProgressToken, begin WorkDoneProgressBegin) (*Progress, error) {
+	progressCtx, cancel := context.WithCancel(ctx)
+
+	progress := &Progress{
+		manager:    manager,
+		ctx:        progressCtx,
+		cancel:     cancel,
+		token:      token,
+		percentage: clampPercentage(begin.Percentage),
+	}
+
+	if token == "" {
+		if !manager.supported {
+			progress.ended = true
+			return progress, nil
+		}
+
+		manager.mu.Lock()
+		manager.counter++
+		progress.token = ProgressToken("progress-" + strconv.FormatUint(manager.counter, 10))
+		manager.mu.Unlock()
+
+		params := WorkDoneProgressCreateParams{Token: progress.token}
+		if err := manager.conn.Call(ctx, "window/workDoneProgress/create", params, nil); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	manager.mu.Lock()
+	manager.active[progress.token] = progress
+	manager.mu.Unlock()
+
+	begin.Kind = "begin"
+	begin.Percentage = progress.percentage
+
+	err := manager.conn.Notify(ctx, "$/progress", ProgressParams{Token: progress.token, Value: begin})
+	if err != nil {
+		progress.ended = true
+		progress.release()
+		return nil, err
+	}
+
+	progress.sent = time.Now()
+	return progress, nil
+}
+
+// Cancel handles a `window/workDoneProgress/cancel` notification by canceling
+// the context of the progress with the given token.
+func (manager *ProgressManager) Cancel(params *WorkDoneProgressCancelParams) {
+	manager.mu.Lock()
+	progress, ok := manager.active[params.Token]
+	manager.mu.Unlock()
+
+	if ok {
+		progress.cancel()
+	}
+}
+
+// notify sends a progress payload, passing errors to the error handler.
+func (manager *ProgressManager) notify(token ProgressToken, value interface{}) {
+	err := manager.conn.Notify(context.Background(), "$/progress", ProgressParams{Token: token, Value: value})
+	if err != nil && manager.ErrorHandler != nil {
+		manager.ErrorHandler(err)
+	}
+}
+
+// Progress reports the progress of a single operation. It's started with
+// `ProgressManager.Start` and has to be ended with `End`.
+//
+// Reports are throttled, and percentages never decrease. A Progress is safe
+// for concurrent use.
+type Progress struct {
+	manager *ProgressManager
+	ctx     context.Context
+	cancel  context.CancelFunc
+	token   ProgressToken
+
+	mu         sync.Mutex
+	ended      bool
+	percentage int
+	sent       time.Time
+	pending    *WorkDoneProgressReport
+	timer      *time.Timer
+}
+
+// Token returns the token the progress is reported with, which is empty if
+// the progress doesn't report anything.
+func (progress *Progress) Token() ProgressToken {
+	return progress.token
+}
+
+// Context returns a context that's canceled when the client cancels the
+// operation, when the context passed to `Start` is canceled or when the
+// progress ends.
+func (progress *Progress) Context() context.Context {
+	return progress.ctx
+}
+
+// Report reports the progress of the operation. An empty message keeps the
+// previous one, and a percentage lower than the previous one is raised to
+// it. Reports are sent at most once per interval; if several are made in
+// between, the last one is sent once the interval has passed.
+func (progress *Progress) Report(message string, percentage int) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.ended {
+		return
+	}
+
+	if percentage = clampPercentage(percentage); percentage > progress.percentage {
+		progress.percentage = percentage
+	}
+
+	report := &WorkDoneProgressReport{
+		Kind:       "report",
+		Message:    message,
+		Percentage: progress.percentage,
+	}
+
+	if progress.pending != nil && report.Message == "" {
+		report.Message = progress.pending.Message
+	}
+
+	progress.pending = report
+
+	wait := progress.manager.Interval - time.Since(progress.sent)
+	if wait <= 0 {
+		progress.flush()
+		return
+	}
+
+	if progress.timer == nil {
+		progress.timer = time.AfterFunc(wait, func() {
+			progress.mu.Lock()
+			defer progress.mu.Unlock()
+
+			progress.timer = nil
+			if !progress.ended {
+				progress.flush()
+			}
+		})
+	}
+}
+
+// End ends the progress with an optional final message. Pending reports are
+// dropped, and the context of the progress is canceled. Calling End more than
+// once has no effect.
+func (progress *Progress) End(message string) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	if progress.ended {
+		progress.release()
+		return
+	}
+
+	progress.ended = true
+	progress.pending = nil
+	if progress.timer != nil {
+		progress.timer.Stop()
+		progress.timer = nil
+	}
+
+	progress.manager.notify(progress.token, WorkDoneProgressEnd{Kind: "end", Message: message})
+	progress.release()
+}
+
+// flush sends the pending report, if any. A report made right after the timer
+// fired may have sent it already. It has to be called with the lock held.
+func (progress *Progress) flush() {
+	report := progress.pending
+	if report == nil {
+		return
+	}
+
+	progress.pending = nil
+	progress.sent = time.Now()
+
+	progress.manager.notify(progress.token, *report)
+}
+
+// release cancels the context of the progress and stops routing cancellations
+// to it.
+func (progress *Progress) release() {
+	progress.cancel()
+
+	progress.manager.mu.Lock()
+	if progress.manager.active[progress.token] == progress {
+		delete(progress.manager.active, progress.token)
+	}
+	progress.manager.mu.Unlock()
+}
+
+// clampPercentage limits a percentage to the range from 0 to 100.
+func clampPercentage(percentage int) int {
+	if percentage < 0 {
+		return 0
+	}
+
+	if percentage > 100 {
+		return 100
+	}
+
+	return percentage
+}
@@ -0,0 +1,112 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressConcurrentReports(t *testing.T) {
+	conn := &recordingConn{}
+	capabilities := &ClientCapabilities{}
+	if err := json.Unmarshal([]byte(`{"window":{"workDoneProgress":true}}`), capabilities); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewProgressManager(conn, capabilities)
+	manager.Interval = time.Microsecond
+
+	progress, err := manager.Start(context.Background(), "", WorkDoneProgressBegin{Title: "Indexing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i <= 100; i++ {
+				progress.Report("", i)
+				if i%10 == worker {
+					time.Sleep(time.Microsecond)
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+	progress.End("done")
+
+	last := 0
+	for _, raw := range conn.sent("$/progress") {
+		var params struct {
+			Value struct {
+				Kind       string `json:"kind"`
+				Percentage int    `json:"percentage"`
+			} `json:"value"`
+		}
+
+		if err := json.Unmarshal(raw, &params); err != nil {
+			t.Fatal(err)
+		}
+
+		if params.Value.Kind != "report" {
+			continue
+		}
+
+		if params.Value.Percentage < last {
+			t.Errorf("percentage decreased from %d to %d", last, params.Value.Percentage)
+		}
+
+		last = params.Value.Percentage
+	}
+}
+
+func TestProgressThrottle(t *testing.T) {
+	conn := &recordingConn{}
+	manager := NewProgressManager(conn, nil)
+	manager.Interval = time.Hour
+
+	progress, err := manager.Start(context.Background(), "client-token", WorkDoneProgressBegin{Title: "Indexing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress.Report("1/3", 10)
+	progress.Report("2/3", 5)
+
+	if sent := conn.sent("$/progress"); len(sent) != 1 {
+		t.Fatalf("expected only the begin payload to be sent, got %d messages", len(sent))
+	}
+
+	manager.Cancel(&WorkDoneProgressCancelParams{Token: "client-token"})
+	if progress.Context().Err() == nil {
+		t.Error("expected the context to be canceled")
+	}
+
+	progress.End("")
+	if sent := conn.sent("$/progress"); len(sent) != 2 {
+		t.Errorf("expected begin and end payloads, got %d messages", len(sent))
+	}
+}
+
+func TestProgressUnsupported(t *testing.T) {
+	conn := &recordingConn{}
+
+	progress, err := NewProgressManager(conn, nil).Start(context.Background(), "", WorkDoneProgressBegin{Title: "Indexing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress.Report("", 50)
+	progress.End("")
+
+	if len(conn.messages) != 0 {
+		t.Errorf("expected no messages, got %d", len(conn.messages))
+	}
+}
@@ -0,0 +1,552 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// registrationMethod describes how a method is registered.
+type registrationMethod struct {
+	// The type of the registration options, or nil if the method doesn't
+	// take any.
+	options reflect.Type
+
+	// Sets the options, which are a pointer to a value of the options type,
+	// in the server capabilities. It's nil if the method can only be
+	// registered dynamically.
+	static func(capabilities *ServerCapabilities, options interface{})
+}
+
+// registrationMethods holds the methods that can be registered, along with
+// their registration options.
+var registrationMethods = map[string]registrationMethod{
+	"textDocument/didOpen": {
+		options: reflect.TypeOf(TextDocumentRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).OpenClose = true
+		},
+	},
+	"textDocument/didClose": {
+		options: reflect.TypeOf(TextDocumentRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).OpenClose = true
+		},
+	},
+	"textDocument/didChange": {
+		options: reflect.TypeOf(TextDocumentChangeRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).Change = options.(*TextDocumentChangeRegistrationOptions).SyncKind
+		},
+	},
+	"textDocument/willSave": {
+		options: reflect.TypeOf(TextDocumentRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).WillSave = true
+		},
+	},
+	"textDocument/willSaveWaitUntil": {
+		options: reflect.TypeOf(TextDocumentRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).WillSaveWaitUntil = true
+		},
+	},
+	"textDocument/didSave": {
+		options: reflect.TypeOf(TextDocumentSaveRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			textDocumentSyncOf(capabilities).Save = &SaveOptions{
+				IncludeText: options.(*TextDocumentSaveRegistrationOptions).IncludeText,
+			}
+		},
+	},
+	"textDocument/completion": {
+		options: reflect.TypeOf(CompletionRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.CompletionProvider = &options.(*CompletionRegistrationOptions).CompletionOptions
+		},
+	},
+	"textDocument/hover": {
+		options: reflect.TypeOf(HoverRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.HoverProvider = &options.(*HoverRegistrationOptions).HoverOptions
+		},
+	},
+	"textDocument/signatureHelp": {
+		options: reflect.TypeOf(SignatureHelpRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.SignatureHelpProvider = &options.(*SignatureHelpRegistrationOptions).SignatureHelpOptions
+		},
+	},
+	"textDocument/declaration": {
+		options: reflect.TypeOf(DeclarationRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DeclarationProvider = options.(*DeclarationRegistrationOptions)
+		},
+	},
+	"textDocument/definition": {
+		options: reflect.TypeOf(DefinitionRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DefinitionProvider = options.(*DefinitionRegistrationOptions)
+		},
+	},
+	"textDocument/typeDefinition": {
+		options: reflect.TypeOf(TypeDefinitionRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.TypeDefinitionProvider = options.(*TypeDefinitionRegistrationOptions)
+		},
+	},
+	"textDocument/implementation": {
+		options: reflect.TypeOf(ImplementationRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.ImplementationProvider = options.(*ImplementationRegistrationOptions)
+		},
+	},
+	"textDocument/references": {
+		options: reflect.TypeOf(ReferenceRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.ReferencesProvider = options.(*ReferenceRegistrationOptions)
+		},
+	},
+	"textDocument/documentHighlight": {
+		options: reflect.TypeOf(DocumentHighlightRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentHighlightProvider = options.(*DocumentHighlightRegistrationOptions)
+		},
+	},
+	"textDocument/documentSymbol": {
+		options: reflect.TypeOf(DocumentSymbolRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentSymbolProvider = options.(*DocumentSymbolRegistrationOptions)
+		},
+	},
+	"textDocument/codeAction": {
+		options: reflect.TypeOf(CodeActionRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.CodeActionProvider = options.(*CodeActionRegistrationOptions)
+		},
+	},
+	"textDocument/codeLens": {
+		options: reflect.TypeOf(CodeLensRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.CodeLensProvider = options.(*CodeLensRegistrationOptions)
+		},
+	},
+	"textDocument/documentLink": {
+		options: reflect.TypeOf(DocumentLinkRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentLinkProvider = options.(*DocumentLinkRegistrationOptions)
+		},
+	},
+	"textDocument/documentColor": {
+		options: reflect.TypeOf(DocumentColorRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.ColorProvider = options.(*DocumentColorRegistrationOptions)
+		},
+	},
+	"textDocument/formatting": {
+		options: reflect.TypeOf(DocumentFormattingRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentFormattingProvider = options.(*DocumentFormattingRegistrationOptions)
+		},
+	},
+	"textDocument/rangeFormatting": {
+		options: reflect.TypeOf(DocumentRangeFormattingRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentRangeFormattingProvider = options.(*DocumentRangeFormattingRegistrationOptions)
+		},
+	},
+	"textDocument/onTypeFormatting": {
+		options: reflect.TypeOf(DocumentOnTypeFormattingRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.DocumentOnTypeFormattingProvider = options.(*DocumentOnTypeFormattingRegistrationOptions)
+		},
+	},
+	"textDocument/rename": {
+		options: reflect.TypeOf(RenameRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.RenameProvider = options.(*RenameRegistrationOptions)
+		},
+	},
+	"textDocument/foldingRange": {
+		options: reflect.TypeOf(FoldingRangeRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.FoldingRangeProvider = options.(*FoldingRangeRegistrationOptions)
+		},
+	},
+	"textDocument/selectionRange": {
+		options: reflect.TypeOf(SelectionRangeRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.SelectionRangeProvider = options.(*SelectionRangeRegistrationOptions)
+		},
+	},
+	"textDocument/linkedEditingRange": {
+		options: reflect.TypeOf(LinkedEditingRangeRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.LinkedEditingRangeProvider = options.(*LinkedEditingRangeRegistrationOptions)
+		},
+	},
+	"textDocument/prepareCallHierarchy": {
+		options: reflect.TypeOf(CallHierarchyRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.CallHierarchyProvider = options.(*CallHierarchyRegistrationOptions)
+		},
+	},
+	"textDocument/semanticTokens": {
+		options: reflect.TypeOf(SemanticTokensRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.SemanticTokensProvider = options.(*SemanticTokensRegistrationOptions)
+		},
+	},
+	"textDocument/moniker": {
+		options: reflect.TypeOf(MonikerRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.MonikerProvider = options.(*MonikerRegistrationOptions)
+		},
+	},
+	"workspace/symbol": {
+		options: reflect.TypeOf(WorkspaceSymbolRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.WorkspaceSymbolProvider = options.(*WorkspaceSymbolRegistrationOptions)
+		},
+	},
+	"workspace/executeCommand": {
+		options: reflect.TypeOf(ExecuteCommandRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			capabilities.ExecuteCommandProvider = options.(*ExecuteCommandRegistrationOptions)
+		},
+	},
+	"workspace/didChangeConfiguration": {},
+	"workspace/didChangeWatchedFiles": {
+		options: reflect.TypeOf(DidChangeWatchedFilesRegistrationOptions{}),
+	},
+	"workspace/didCreateFiles":  fileOperationRegistrationMethod("DidCreate"),
+	"workspace/willCreateFiles": fileOperationRegistrationMethod("WillCreate"),
+	"workspace/didRenameFiles":  fileOperationRegistrationMethod("DidRename"),
+	"workspace/willRenameFiles": fileOperationRegistrationMethod("WillRename"),
+	"workspace/didDeleteFiles":  fileOperationRegistrationMethod("DidDelete"),
+	"workspace/willDeleteFiles": fileOperationRegistrationMethod("WillDelete"),
+}
+
+// textDocumentSyncOf returns the text document sync options of the server
+// capabilities, creating them if needed.
+func textDocumentSyncOf(capabilities *ServerCapabilities) *TextDocumentSyncOptions {
+	if capabilities.TextDocumentSync == nil {
+		capabilities.TextDocumentSync = &TextDocumentSyncOptions{}
+	}
+
+	return capabilities.TextDocumentSync
+}
+
+// workspaceCapabilitiesOf returns the workspace capabilities of the server,
+// creating them if needed. They are an anonymous struct, so they are allocated
+// through reflection and returned as an addressable value.
+func workspaceCapabilitiesOf(capabilities *ServerCapabilities) reflect.Value {
+	workspace := reflect.ValueOf(capabilities).Elem().FieldByName("Workspace")
+	if workspace.IsNil() {
+		workspace.Set(reflect.New(workspace.Type().Elem()))
+	}
+
+	return workspace.Elem()
+}
+
+// fileOperationRegistrationMethod describes a file operation method, whose
+// static options are held by the given field of the file operation server
+// capabilities.
+func fileOperationRegistrationMethod(field string) registrationMethod {
+	return registrationMethod{
+		options: reflect.TypeOf(FileOperationRegistrationOptions{}),
+		static: func(capabilities *ServerCapabilities, options interface{}) {
+			fileOperations := workspaceCapabilitiesOf(capabilities).FieldByName("FileOperations")
+			if fileOperations.IsNil() {
+				fileOperations.Set(reflect.New(fileOperations.Type().Elem()))
+			}
+
+			fileOperations.Elem().FieldByName(field).Set(reflect.ValueOf(options))
+		},
+	}
+}
+
+// registrationOptionsOf checks that options are of the type a method expects,
+// and returns them as a pointer to a copy. Nil options are replaced by the zero
+// value of the type.
+func registrationOptionsOf(method string, options interface{}) (interface{}, error) {
+	registration, ok := registrationMethods[method]
+	if !ok {
+		return nil, fmt.Errorf("method %q can't be registered", method)
+	}
+
+	if registration.options == nil {
+		if options != nil {
+			return nil, fmt.Errorf("method %q doesn't take registration options, got %T", method, options)
+		}
+
+		return nil, nil
+	}
+
+	copied := reflect.New(registration.options)
+	if options == nil {
+		return copied.Interface(), nil
+	}
+
+	value := reflect.ValueOf(options)
+	if value.Kind() == reflect.Ptr && value.Type().Elem() == registration.options {
+		if value.IsNil() {
+			return copied.Interface(), nil
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Type() != registration.options {
+		return nil, fmt.Errorf("method %q expects registration options of type %v, got %T", method, registration.options, options)
+	}
+
+	copied.Elem().Set(value)
+	return copied.Interface(), nil
+}
+
+// RegistrationManager registers the features of a server with the client. A
+// feature is registered dynamically through `client/registerCapability` if the
+// client supports dynamic registration for its method, and statically in the
+// server capabilities otherwise.
+//
+// Features registered before the client sent the `initialized` notification
+// are either added to the capabilities returned by `ServerCapabilities`, which
+// the server sends in its initialize result, or queued until `Initialized` is
+// called. Afterwards, features can only be registered dynamically.
+//
+// A RegistrationManager is safe for concurrent use.
+type RegistrationManager struct {
+	conn         Conn
+	capabilities *ClientCapabilities
+
+	mu            sync.Mutex
+	initialized   bool
+	static        ServerCapabilities
+	staticMethods map[string]bool
+	registrations map[string]Registration
+	pending       []Registration
+	counter       uint64
+}
+
+// NewRegistrationManager instantiates a RegistrationManager that registers
+// features over conn, based on the capabilities of the client.
+func NewRegistrationManager(conn Conn, capabilities *ClientCapabilities) *RegistrationManager {
+	return &RegistrationManager{
+		conn:          conn,
+		capabilities:  capabilities,
+		staticMethods: map[string]bool{},
+		registrations: map[string]Registration{},
+	}
+}
+
+// Register registers a feature. The options have to be of the registration
+// options type of the method, like `CompletionRegistrationOptions` for
+// `textDocument/completion`, or a pointer to one.
+//
+// For dynamic registrations, it returns the ID of the registration, which can
+// be passed to `Unregister`. For static ones, the ID is empty.
+func (manager *RegistrationManager) Register(ctx context.Context, method string, options interface{}) (string, error) {
+	options, err := registrationOptionsOf(method, options)
+	if err != nil {
+		return "", err
+	}
+
+	manager.mu.Lock()
+
+	if !manager.capabilities.SupportsDynamicRegistration(method) {
+		defer manager.mu.Unlock()
+
+		static := registrationMethods[method].static
+		if static == nil {
+			return "", fmt.Errorf("client doesn't support dynamic registration of %q", method)
+		}
+
+		if manager.initialized {
+			return "", fmt.Errorf("%q can't be registered statically after initialization", method)
+		}
+
+		static(&manager.static, options)
+		manager.staticMethods[method] = true
+		return "", nil
+	}
+
+	manager.counter++
+	registration := Registration{
+		ID:              "registration-" + strconv.FormatUint(manager.counter, 10),
+		Method:          method,
+		RegisterOptions: options,
+	}
+
+	manager.registrations[registration.ID] = registration
+
+	if !manager.initialized {
+		manager.pending = append(manager.pending, registration)
+		manager.mu.Unlock()
+
+		return registration.ID, nil
+	}
+
+	manager.mu.Unlock()
+
+	params := RegistrationParams{Registrations: []Registration{registration}}
+	if err := manager.conn.Call(ctx, "client/registerCapability", params, nil); err != nil {
+		manager.mu.Lock()
+		delete(manager.registrations, registration.ID)
+		manager.mu.Unlock()
+
+		return "", err
+	}
+
+	return registration.ID, nil
+}
+
+// ServerCapabilities returns the capabilities of the features registered
+// statically.
+func (manager *RegistrationManager) ServerCapabilities() ServerCapabilities {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.static
+}
+
+// Initialized sends the dynamic registrations made before the client sent the
+// `initialized` notification. It has to be called once that notification has
+// been received.
+func (manager *RegistrationManager) Initialized(ctx context.Context) error {
+	manager.mu.Lock()
+	manager.initialized = true
+	pending := manager.pending
+	manager.pending = nil
+	manager.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	params := RegistrationParams{Registrations: pending}
+	if err := manager.conn.Call(ctx, "client/registerCapability", params, nil); err != nil {
+		manager.mu.Lock()
+		for _, registration := range pending {
+			delete(manager.registrations, registration.ID)
+		}
+		manager.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// Registrations returns the active dynamic registrations.
+func (manager *RegistrationManager) Registrations() []Registration {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	registrations := make([]Registration, 0, len(manager.registrations))
+	for _, registration := range manager.registrations {
+		registrations = append(registrations, registration)
+	}
+
+	return registrations
+}
+
+// IsRegistered reports whether a method has been registered, either
+// statically or dynamically.
+func (manager *RegistrationManager) IsRegistered(method string) bool {
+	manager.mu.Lock()
+	static := manager.staticMethods[method]
+	manager.mu.Unlock()
+
+	return static || manager.isRegisteredDynamically(method)
+}
+
+// isRegisteredDynamically reports whether a method has an active or pending
+// dynamic registration.
+func (manager *RegistrationManager) isRegisteredDynamically(method string) bool {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	for _, registration := range manager.registrations {
+		if registration.Method == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unregister removes the dynamic registration with the given ID.
+func (manager *RegistrationManager) Unregister(ctx context.Context, id string) error {
+	manager.mu.Lock()
+	registration, ok := manager.registrations[id]
+	manager.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no registration with ID %q", id)
+	}
+
+	return manager.unregister(ctx, []Registration{registration})
+}
+
+// UnregisterMethod removes all dynamic registrations of a method. Features
+// registered statically can't be unregistered.
+func (manager *RegistrationManager) UnregisterMethod(ctx context.Context, method string) error {
+	manager.mu.Lock()
+	static := manager.staticMethods[method]
+
+	var registrations []Registration
+	for _, registration := range manager.registrations {
+		if registration.Method == method {
+			registrations = append(registrations, registration)
+		}
+	}
+	manager.mu.Unlock()
+
+	if static {
+		return fmt.Errorf("%q has been registered statically and can't be unregistered", method)
+	}
+
+	if len(registrations) == 0 {
+		return nil
+	}
+
+	return manager.unregister(ctx, registrations)
+}
+
+// unregister removes dynamic registrations, telling the client about those
+// that have already been sent.
+func (manager *RegistrationManager) unregister(ctx context.Context, registrations []Registration) error {
+	manager.mu.Lock()
+
+	var params UnregistrationParams
+	for _, registration := range registrations {
+		delete(manager.registrations, registration.ID)
+
+		pending := false
+		for i, candidate := range manager.pending {
+			if candidate.ID == registration.ID {
+				manager.pending = append(manager.pending[:i], manager.pending[i+1:]...)
+				pending = true
+				break
+			}
+		}
+
+		if !pending {
+			params.Unregistrations = append(params.Unregistrations, Unregistration{
+				ID:     registration.ID,
+				Method: registration.Method,
+			})
+		}
+	}
+
+	manager.mu.Unlock()
+
+	if len(params.Unregistrations) == 0 {
+		return nil
+	}
+
+	return manager.conn.Call(ctx, "client/unregisterCapability", params, nil)
+}
@@ -0,0 +1,228 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// newTestRegistrationManager instantiates a RegistrationManager for a client
+// that supports dynamic registration of completion and hover only.
+func newTestRegistrationManager(t *testing.T, conn Conn) *RegistrationManager {
+	t.Helper()
+
+	capabilities := &ClientCapabilities{}
+	raw := `{"textDocument":{"completion":{"dynamicRegistration":true},"hover":{"dynamicRegistration":true}}}`
+	if err := json.Unmarshal([]byte(raw), capabilities); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewRegistrationManager(conn, capabilities)
+}
+
+// sentRegistrations decodes the `client/registerCapability` requests sent over
+// conn.
+func sentRegistrations(t *testing.T, conn *recordingConn) []RegistrationParams {
+	t.Helper()
+
+	var sent []RegistrationParams
+	for _, raw := range conn.sent("client/registerCapability") {
+		var params RegistrationParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			t.Fatal(err)
+		}
+
+		sent = append(sent, params)
+	}
+
+	return sent
+}
+
+func TestRegistrationManagerStatic(t *testing.T) {
+	ctx := context.Background()
+	conn := &recordingConn{}
+	manager := newTestRegistrationManager(t, conn)
+
+	options := DefinitionRegistrationOptions{}
+	options.WorkDoneProgress = true
+
+	id, err := manager.Register(ctx, "textDocument/definition", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "" {
+		t.Errorf("expected a static registration without ID, got %q", id)
+	}
+
+	if _, err := manager.Register(ctx, "workspace/didCreateFiles", &FileOperationRegistrationOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	capabilities := manager.ServerCapabilities()
+	if capabilities.DefinitionProvider == nil || !capabilities.DefinitionProvider.WorkDoneProgress {
+		t.Errorf("expected the definition provider to be announced, got %+v", capabilities.DefinitionProvider)
+	}
+
+	if capabilities.Workspace == nil || capabilities.Workspace.FileOperations == nil || capabilities.Workspace.FileOperations.DidCreate == nil {
+		t.Errorf("expected the file creations to be announced, got %+v", capabilities.Workspace)
+	}
+
+	if !manager.IsRegistered("textDocument/definition") || manager.IsRegistered("textDocument/references") {
+		t.Error("expected only the registered methods to be reported as registered")
+	}
+
+	if err := manager.UnregisterMethod(ctx, "textDocument/definition"); err == nil {
+		t.Error("static registration has been unregistered")
+	}
+
+	if err := manager.Initialized(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Register(ctx, "textDocument/references", nil); err == nil {
+		t.Error("static registration after initialization has been accepted")
+	}
+
+	if len(conn.messages) != 0 {
+		t.Errorf("expected no messages for static registrations, got %+v", conn.messages)
+	}
+}
+
+func TestRegistrationManagerDynamic(t *testing.T) {
+	ctx := context.Background()
+	conn := &recordingConn{}
+	manager := newTestRegistrationManager(t, conn)
+
+	completion, err := manager.Register(ctx, "textDocument/completion", &CompletionRegistrationOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hover, err := manager.Register(ctx, "textDocument/hover", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if completion == "" || hover == "" || completion == hover {
+		t.Fatalf("expected distinct registration IDs, got %q and %q", completion, hover)
+	}
+
+	if capabilities := manager.ServerCapabilities(); capabilities.CompletionProvider != nil || capabilities.HoverProvider != nil {
+		t.Errorf("dynamic registrations have been announced statically: %+v", capabilities)
+	}
+
+	// A registration that hasn't been sent yet is dropped without telling
+	// the client.
+	if err := manager.Unregister(ctx, hover); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conn.messages) != 0 {
+		t.Errorf("expected registrations to be held back until initialization, got %+v", conn.messages)
+	}
+
+	if err := manager.Initialized(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sentRegistrations(t, conn)
+	if len(sent) != 1 || len(sent[0].Registrations) != 1 || sent[0].Registrations[0].ID != completion {
+		t.Fatalf("expected the pending completion registration to be sent, got %+v", sent)
+	}
+
+	if _, err := manager.Register(ctx, "textDocument/hover", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := sentRegistrations(t, conn); len(sent) != 2 || sent[1].Registrations[0].Method != "textDocument/hover" {
+		t.Errorf("expected the hover registration to be sent right away, got %+v", sent)
+	}
+
+	if !manager.IsRegistered("textDocument/completion") || len(manager.Registrations()) != 2 {
+		t.Errorf("expected two active registrations, got %+v", manager.Registrations())
+	}
+
+	if err := manager.UnregisterMethod(ctx, "textDocument/completion"); err != nil {
+		t.Fatal(err)
+	}
+
+	unregistrations := conn.sent("client/unregisterCapability")
+	if len(unregistrations) != 1 {
+		t.Fatalf("expected one unregistration, got %d", len(unregistrations))
+	}
+
+	var params UnregistrationParams
+	if err := json.Unmarshal(unregistrations[0], &params); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Unregistration{{ID: completion, Method: "textDocument/completion"}}
+	if len(params.Unregistrations) != 1 || params.Unregistrations[0] != expected[0] {
+		t.Errorf("expected unregistrations %+v, got %+v", expected, params.Unregistrations)
+	}
+
+	if manager.IsRegistered("textDocument/completion") {
+		t.Error("unregistered method is still reported as registered")
+	}
+
+	if err := manager.Unregister(ctx, completion); err == nil {
+		t.Error("unknown registration has been unregistered")
+	}
+}
+
+func TestRegistrationManagerFailedRegistration(t *testing.T) {
+	ctx := context.Background()
+	conn := &recordingConn{
+		respond: func(method string, params interface{}) (interface{}, error) {
+			return nil, errors.New("rejected")
+		},
+	}
+
+	manager := newTestRegistrationManager(t, conn)
+
+	if _, err := manager.Register(ctx, "textDocument/completion", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.Initialized(ctx); err == nil {
+		t.Error("expected the rejected pending registrations to be reported")
+	}
+
+	if _, err := manager.Register(ctx, "textDocument/hover", nil); err == nil {
+		t.Error("expected the rejected registration to be reported")
+	}
+
+	if registrations := manager.Registrations(); len(registrations) != 0 {
+		t.Errorf("expected rejected registrations to be dropped, got %+v", registrations)
+	}
+}
+
+func TestRegistrationManagerOptions(t *testing.T) {
+	ctx := context.Background()
+	manager := newTestRegistrationManager(t, &recordingConn{})
+
+	tests := []struct {
+		method  string
+		options interface{}
+	}{
+		{"textDocument/completion", &HoverRegistrationOptions{}},
+		{"textDocument/completion", 42},
+		{"workspace/didChangeConfiguration", &HoverRegistrationOptions{}},
+		{"custom/method", nil},
+		// The client doesn't support dynamic registration of watched files,
+		// which can't be announced statically.
+		{"workspace/didChangeWatchedFiles", nil},
+	}
+
+	for _, test := range tests {
+		if _, err := manager.Register(ctx, test.method, test.options); err == nil {
+			t.Errorf("%s: options %#v have been accepted", test.method, test.options)
+		}
+	}
+
+	if _, err := manager.Register(ctx, "textDocument/completion", (*CompletionRegistrationOptions)(nil)); err != nil {
+		t.Errorf("expected nil options to be replaced by the zero value, got %v", err)
+	}
+}
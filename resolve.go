@@ -0,0 +1,274 @@
+package lsp
+
+// lazyProperties splits the expensive properties of an item into the ones the
+// client can resolve lazily and the ones that have to be computed eagerly.
+type lazyProperties struct {
+	eager []string
+	lazy  []string
+}
+
+func newLazyProperties(expensive []string, resolvable []string) lazyProperties {
+	isResolvable := map[string]bool{}
+	for _, property := range resolvable {
+		isResolvable[property] = true
+	}
+
+	properties := lazyProperties{}
+	for _, property := range expensive {
+		if isResolvable[property] {
+			properties.lazy = append(properties.lazy, property)
+		} else {
+			properties.eager = append(properties.eager, property)
+		}
+	}
+
+	return properties
+}
+
+// CompletionItemResolveFunc fills in the given properties of a completion item,
+// like `documentation` or `detail`.
+type CompletionItemResolveFunc func(item *CompletionItem, properties []string) error
+
+// CompletionItemResolver computes the expensive properties of completion items
+// in two phases. `Prepare` is called on the cheap items returned by a
+// `textDocument/completion` handler and computes the properties the client
+// can't resolve lazily, and `Resolve` computes the remaining ones in a
+// `completionItem/resolve` handler.
+type CompletionItemResolver struct {
+	properties lazyProperties
+	resolve    CompletionItemResolveFunc
+}
+
+// NewCompletionItemResolver instantiates a CompletionItemResolver. The
+// properties are the expensive properties resolve is able to compute, named as
+// in the protocol. The ones the client can resolve lazily are taken from its
+// `resolveSupport`. If capabilities is nil or the client doesn't advertise
+// `resolveSupport`, every property is computed eagerly, even though older
+// clients may resolve `documentation` and `detail` lazily.
+func NewCompletionItemResolver(capabilities *CompletionClientCapabilities, properties []string, resolve CompletionItemResolveFunc) *CompletionItemResolver {
+	var resolvable []string
+	if capabilities != nil {
+		resolvable = capabilities.CompletionItem.ResolveSupport.Properties
+	}
+
+	return &CompletionItemResolver{
+		properties: newLazyProperties(properties, resolvable),
+		resolve:    resolve,
+	}
+}
+
+// ResolveProvider reports whether any property is resolved lazily, and should
+// be used as the value of `CompletionOptions.ResolveProvider`.
+func (resolver *CompletionItemResolver) ResolveProvider() bool {
+	return len(resolver.properties.lazy) > 0
+}
+
+// Prepare computes the properties the client can't resolve lazily for every
+// item.
+func (resolver *CompletionItemResolver) Prepare(items []CompletionItem) error {
+	if len(resolver.properties.eager) == 0 {
+		return nil
+	}
+
+	for i := range items {
+		if err := resolver.resolve(&items[i], resolver.properties.eager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve computes the properties the client resolves lazily.
+func (resolver *CompletionItemResolver) Resolve(item CompletionItem) (CompletionItem, error) {
+	if len(resolver.properties.lazy) == 0 {
+		return item, nil
+	}
+
+	err := resolver.resolve(&item, resolver.properties.lazy)
+	return item, err
+}
+
+// CodeActionResolveFunc fills in the given properties of a code action, like
+// `edit` or `command`.
+type CodeActionResolveFunc func(action *CodeAction, properties []string) error
+
+// CodeActionResolver computes the expensive properties of code actions in two
+// phases. `Prepare` is called on the cheap actions returned by a
+// `textDocument/codeAction` handler and computes the properties the client
+// can't resolve lazily, and `Resolve` computes the remaining ones in a
+// `codeAction/resolve` handler.
+type CodeActionResolver struct {
+	properties lazyProperties
+	resolve    CodeActionResolveFunc
+}
+
+// NewCodeActionResolver instantiates a CodeActionResolver. The properties are
+// the expensive properties resolve is able to compute, named as in the
+// protocol. The ones the client can resolve lazily are taken from its
+// `resolveSupport`. If capabilities is nil, every property is computed
+// eagerly.
+func NewCodeActionResolver(capabilities *CodeActionClientCapabilities, properties []string, resolve CodeActionResolveFunc) *CodeActionResolver {
+	var resolvable []string
+	if capabilities != nil {
+		resolvable = capabilities.ResolveSupport.Properties
+	}
+
+	return &CodeActionResolver{
+		properties: newLazyProperties(properties, resolvable),
+		resolve:    resolve,
+	}
+}
+
+// ResolveProvider reports whether any property is resolved lazily, and should
+// be used as the value of `CodeActionOptions.ResolveProvider`.
+func (resolver *CodeActionResolver) ResolveProvider() bool {
+	return len(resolver.properties.lazy) > 0
+}
+
+// Prepare computes the properties the client can't resolve lazily for every
+// action.
+func (resolver *CodeActionResolver) Prepare(actions []CodeAction) error {
+	if len(resolver.properties.eager) == 0 {
+		return nil
+	}
+
+	for i := range actions {
+		if err := resolver.resolve(&actions[i], resolver.properties.eager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve computes the properties the client resolves lazily.
+func (resolver *CodeActionResolver) Resolve(action CodeAction) (CodeAction, error) {
+	if len(resolver.properties.lazy) == 0 {
+		return action, nil
+	}
+
+	err := resolver.resolve(&action, resolver.properties.lazy)
+	return action, err
+}
+
+// CodeLensResolveFunc fills in the given properties of a CodeLens. The only
+// property that can be resolved is `command`.
+type CodeLensResolveFunc func(lens *CodeLens, properties []string) error
+
+// CodeLensResolver computes the command of CodeLens items in two phases.
+// `Prepare` is called on the CodeLens items returned by a
+// `textDocument/codeLens` handler, and `Resolve` computes the command in a
+// `codeLens/resolve` handler. Every client supports resolving the command, so
+// `Prepare` only does work if the resolver is set up to be eager.
+type CodeLensResolver struct {
+	properties lazyProperties
+	resolve    CodeLensResolveFunc
+}
+
+// NewCodeLensResolver instantiates a CodeLensResolver. If eager is set, the
+// command is computed by `Prepare` instead of `Resolve`, e.g. for clients that
+// don't send any CodeLens capabilities.
+func NewCodeLensResolver(eager bool, resolve CodeLensResolveFunc) *CodeLensResolver {
+	resolvable := []string{"command"}
+	if eager {
+		resolvable = nil
+	}
+
+	return &CodeLensResolver{
+		properties: newLazyProperties([]string{"command"}, resolvable),
+		resolve:    resolve,
+	}
+}
+
+// ResolveProvider reports whether the command is resolved lazily, and should
+// be used as the value of `CodeLensOptions.ResolveProvider`.
+func (resolver *CodeLensResolver) ResolveProvider() bool {
+	return len(resolver.properties.lazy) > 0
+}
+
+// Prepare computes the command of every CodeLens if it isn't resolved lazily.
+func (resolver *CodeLensResolver) Prepare(lenses []CodeLens) error {
+	if len(resolver.properties.eager) == 0 {
+		return nil
+	}
+
+	for i := range lenses {
+		if err := resolver.resolve(&lenses[i], resolver.properties.eager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve computes the command of a CodeLens if it's resolved lazily.
+func (resolver *CodeLensResolver) Resolve(lens CodeLens) (CodeLens, error) {
+	if len(resolver.properties.lazy) == 0 {
+		return lens, nil
+	}
+
+	err := resolver.resolve(&lens, resolver.properties.lazy)
+	return lens, err
+}
+
+// DocumentLinkResolveFunc fills in the given properties of a document link,
+// like `target` or `tooltip`.
+type DocumentLinkResolveFunc func(link *DocumentLink, properties []string) error
+
+// DocumentLinkResolver computes the expensive properties of document links in
+// two phases. `Prepare` is called on the links returned by a
+// `textDocument/documentLink` handler, and `Resolve` computes the remaining
+// properties in a `documentLink/resolve` handler. Clients can always resolve
+// the `target` of a link lazily; every other property is computed eagerly.
+type DocumentLinkResolver struct {
+	properties lazyProperties
+	resolve    DocumentLinkResolveFunc
+}
+
+// NewDocumentLinkResolver instantiates a DocumentLinkResolver. The properties
+// are the expensive properties resolve is able to compute, named as in the
+// protocol. If capabilities is nil, every property is computed eagerly.
+func NewDocumentLinkResolver(capabilities *DocumentLinkClientCapabilities, properties []string, resolve DocumentLinkResolveFunc) *DocumentLinkResolver {
+	var resolvable []string
+	if capabilities != nil {
+		resolvable = []string{"target"}
+	}
+
+	return &DocumentLinkResolver{
+		properties: newLazyProperties(properties, resolvable),
+		resolve:    resolve,
+	}
+}
+
+// ResolveProvider reports whether any property is resolved lazily, and should
+// be used as the value of `DocumentLinkOptions.ResolveProvider`.
+func (resolver *DocumentLinkResolver) ResolveProvider() bool {
+	return len(resolver.properties.lazy) > 0
+}
+
+// Prepare computes the properties the client can't resolve lazily for every
+// link.
+func (resolver *DocumentLinkResolver) Prepare(links []DocumentLink) error {
+	if len(resolver.properties.eager) == 0 {
+		return nil
+	}
+
+	for i := range links {
+		if err := resolver.resolve(&links[i], resolver.properties.eager); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resolve computes the properties the client resolves lazily.
+func (resolver *DocumentLinkResolver) Resolve(link DocumentLink) (DocumentLink, error) {
+	if len(resolver.properties.lazy) == 0 {
+		return link, nil
+	}
+
+	err := resolver.resolve(&link, resolver.properties.lazy)
+	return link, err
+}
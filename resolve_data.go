@@ -0,0 +1,223 @@
+package lsp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ResolveDataKind identifies the kind of item a `Data` payload is attached to.
+type ResolveDataKind string
+
+const (
+	// RDKCompletionItem is the kind of `CompletionItem.Data`, which comes back
+	// in `completionItem/resolve` requests.
+	RDKCompletionItem ResolveDataKind = "completionItem"
+
+	// RDKCodeAction is the kind of `CodeAction.Data`, which comes back in
+	// `codeAction/resolve` requests.
+	RDKCodeAction ResolveDataKind = "codeAction"
+
+	// RDKCodeLens is the kind of `CodeLens.Data`, which comes back in
+	// `codeLens/resolve` requests.
+	RDKCodeLens ResolveDataKind = "codeLens"
+
+	// RDKDocumentLink is the kind of `DocumentLink.Data`, which comes back in
+	// `documentLink/resolve` requests.
+	RDKDocumentLink ResolveDataKind = "documentLink"
+
+	// RDKCallHierarchyItem is the kind of `CallHierarchyItem.Data`, which comes
+	// back in `callHierarchy/incomingCalls` and `callHierarchy/outgoingCalls`
+	// requests.
+	RDKCallHierarchyItem ResolveDataKind = "callHierarchyItem"
+)
+
+var (
+	// ErrResolveDataTampered is returned by `ResolveDataCodec.Decode` if a
+	// payload wasn't produced by the codec or has been modified since.
+	ErrResolveDataTampered = errors.New("resolve data has been tampered with")
+
+	// ErrResolveDataStale is returned by `ResolveDataCodec.Decode` if a payload
+	// has been invalidated or is older than the codec's maximum age.
+	ErrResolveDataStale = errors.New("resolve data is stale")
+)
+
+// ResolveDataCodec attaches typed values to the `Data` field of items that
+// are resolved later on, and decodes them back into the same Go type once the
+// item comes back from the client, where they would otherwise arrive as a
+// `map[string]interface{}`.
+//
+// Payloads are wrapped in an envelope that is signed with an HMAC, so values
+// that were modified by the client are rejected. Every payload also records
+// the generation of the codec and the time it was created at; payloads from
+// an earlier generation (see `Invalidate`) or older than `MaxAge` are rejected
+// as stale. A ResolveDataCodec is safe for concurrent use once it has been
+// set up.
+type ResolveDataCodec struct {
+	// The maximum age of a payload. Zero means payloads never expire.
+	MaxAge time.Duration
+
+	mu         sync.RWMutex
+	key        []byte
+	types      map[ResolveDataKind]reflect.Type
+	generation uint64
+}
+
+// resolveDataEnvelope is what ends up in the `Data` field of an item. The
+// payload is kept as a JSON string, so that it survives the round trip through
+// the client byte for byte and its signature can be verified. The time is
+// stored in milliseconds, since clients may decode numbers as doubles.
+type resolveDataEnvelope struct {
+	Kind       ResolveDataKind `json:"kind"`
+	Generation uint64          `json:"generation"`
+	Time       int64           `json:"time"`
+	Payload    string          `json:"payload"`
+	Signature  string          `json:"signature"`
+}
+
+// MinResolveDataKeyLength is the minimum length in bytes of the key a
+// ResolveDataCodec signs its payloads with.
+const MinResolveDataKeyLength = 16
+
+// NewResolveDataCodec instantiates a ResolveDataCodec that signs its payloads
+// with the given key. The key should be random, at least
+// `MinResolveDataKeyLength` bytes long and kept for the lifetime of the
+// server. Shorter keys are rejected, since they would make the signature
+// useless.
+func NewResolveDataCodec(key []byte) (*ResolveDataCodec, error) {
+	if len(key) < MinResolveDataKeyLength {
+		return nil, fmt.Errorf("resolve data key has to be at least %d bytes long, got %d", MinResolveDataKeyLength, len(key))
+	}
+
+	return &ResolveDataCodec{
+		key:   append([]byte{}, key...),
+		types: map[ResolveDataKind]reflect.Type{},
+	}, nil
+}
+
+// Register associates a Go type with a kind of item. The type is taken from
+// prototype, which can be a value or a pointer; `Decode` returns values of
+// exactly that type.
+func (codec *ResolveDataCodec) Register(kind ResolveDataKind, prototype interface{}) {
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+
+	codec.types[kind] = reflect.TypeOf(prototype)
+}
+
+// Invalidate marks all payloads encoded so far as stale, e.g. after the
+// workspace has changed in a way that makes them meaningless.
+func (codec *ResolveDataCodec) Invalidate() {
+	codec.mu.Lock()
+	defer codec.mu.Unlock()
+
+	codec.generation++
+}
+
+// Encode wraps a value into a signed envelope that can be assigned to the
+// `Data` field of an item of the given kind. The value has to be of the type
+// registered for the kind.
+func (codec *ResolveDataCodec) Encode(kind ResolveDataKind, value interface{}) (interface{}, error) {
+	codec.mu.RLock()
+	defer codec.mu.RUnlock()
+
+	valueType, ok := codec.types[kind]
+	if !ok {
+		return nil, fmt.Errorf("no type is registered for %s data", kind)
+	}
+
+	if reflect.TypeOf(value) != valueType {
+		return nil, fmt.Errorf("%s data has to be of type %s, got %T", kind, valueType, value)
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := &resolveDataEnvelope{
+		Kind:       kind,
+		Generation: codec.generation,
+		Time:       time.Now().UnixNano() / int64(time.Millisecond),
+		Payload:    string(payload),
+	}
+
+	envelope.Signature = codec.sign(envelope)
+	return envelope, nil
+}
+
+// Decode verifies a `Data` field received from the client and decodes it into
+// the type registered for the given kind. It fails with
+// `ErrResolveDataTampered` if the envelope is malformed, belongs to another
+// kind or has an invalid signature, and with `ErrResolveDataStale` if it has
+// expired.
+func (codec *ResolveDataCodec) Decode(kind ResolveDataKind, data interface{}) (interface{}, error) {
+	codec.mu.RLock()
+	defer codec.mu.RUnlock()
+
+	valueType, ok := codec.types[kind]
+	if !ok {
+		return nil, fmt.Errorf("no type is registered for %s data", kind)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, ErrResolveDataTampered
+	}
+
+	envelope := &resolveDataEnvelope{}
+	if err := json.Unmarshal(raw, envelope); err != nil || envelope.Kind != kind {
+		return nil, ErrResolveDataTampered
+	}
+
+	if !hmac.Equal([]byte(envelope.Signature), []byte(codec.sign(envelope))) {
+		return nil, ErrResolveDataTampered
+	}
+
+	if envelope.Generation != codec.generation {
+		return nil, ErrResolveDataStale
+	}
+
+	if codec.MaxAge > 0 && time.Since(time.Unix(0, envelope.Time*int64(time.Millisecond))) > codec.MaxAge {
+		return nil, ErrResolveDataStale
+	}
+
+	isPointer := valueType.Kind() == reflect.Ptr
+	elementType := valueType
+	if isPointer {
+		elementType = valueType.Elem()
+	}
+
+	value := reflect.New(elementType)
+	if err := json.Unmarshal([]byte(envelope.Payload), value.Interface()); err != nil {
+		return nil, fmt.Errorf("could not decode %s data: %v", kind, err)
+	}
+
+	if isPointer {
+		return value.Interface(), nil
+	}
+
+	return value.Elem().Interface(), nil
+}
+
+// sign computes the signature of an envelope.
+func (codec *ResolveDataCodec) sign(envelope *resolveDataEnvelope) string {
+	mac := hmac.New(sha256.New, codec.key)
+
+	mac.Write([]byte(envelope.Kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatUint(envelope.Generation, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(envelope.Time, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(envelope.Payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
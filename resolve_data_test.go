@@ -0,0 +1,163 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testResolveData struct {
+	Symbol string `json:"symbol"`
+	Offset int    `json:"offset"`
+}
+
+var testResolveDataKey = []byte("0123456789abcdef")
+
+// newTestResolveDataCodec instantiates a codec with completion items carrying
+// `testResolveData` and code lenses carrying `*testResolveData`.
+func newTestResolveDataCodec(t *testing.T, key []byte) *ResolveDataCodec {
+	t.Helper()
+
+	codec, err := NewResolveDataCodec(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec.Register(RDKCompletionItem, testResolveData{})
+	codec.Register(RDKCodeLens, &testResolveData{})
+	return codec
+}
+
+// throughClient encodes data as JSON and decodes it again, like it would be
+// after a round trip through the client.
+func throughClient(t *testing.T, data interface{}) interface{} {
+	t.Helper()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
+
+func TestNewResolveDataCodecKeys(t *testing.T) {
+	for _, key := range [][]byte{nil, {}, []byte("short")} {
+		if _, err := NewResolveDataCodec(key); err == nil {
+			t.Errorf("key %q has been accepted", key)
+		}
+	}
+}
+
+func TestResolveDataRoundTrip(t *testing.T) {
+	codec := newTestResolveDataCodec(t, testResolveDataKey)
+	value := testResolveData{Symbol: "fmt.Println", Offset: 42}
+
+	tests := []struct {
+		kind     ResolveDataKind
+		value    interface{}
+		expected interface{}
+	}{
+		{RDKCompletionItem, value, value},
+		{RDKCodeLens, &value, &value},
+	}
+
+	for _, test := range tests {
+		data, err := codec.Encode(test.kind, test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := codec.Decode(test.kind, throughClient(t, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(decoded, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.kind, test.expected, decoded)
+		}
+	}
+
+	if _, err := codec.Encode(RDKCompletionItem, &value); err == nil {
+		t.Error("value of the wrong type has been encoded")
+	}
+
+	if _, err := codec.Encode(RDKCodeAction, value); err == nil {
+		t.Error("value of an unregistered kind has been encoded")
+	}
+}
+
+func TestResolveDataTampered(t *testing.T) {
+	codec := newTestResolveDataCodec(t, testResolveDataKey)
+
+	data, err := codec.Encode(RDKCompletionItem, testResolveData{Symbol: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := []func(envelope map[string]interface{}){
+		func(envelope map[string]interface{}) { envelope["payload"] = `{"symbol":"b","offset":0}` },
+		func(envelope map[string]interface{}) { envelope["signature"] = "forged" },
+		func(envelope map[string]interface{}) { delete(envelope, "signature") },
+		func(envelope map[string]interface{}) { envelope["time"] = 0 },
+		func(envelope map[string]interface{}) { envelope["kind"] = string(RDKCodeLens) },
+	}
+
+	for i, change := range tamper {
+		envelope := throughClient(t, data).(map[string]interface{})
+		change(envelope)
+
+		if _, err := codec.Decode(RDKCompletionItem, envelope); err != ErrResolveDataTampered {
+			t.Errorf("change %d: expected ErrResolveDataTampered, got %v", i, err)
+		}
+	}
+
+	for _, data := range []interface{}{nil, "data", 42, map[string]interface{}{"symbol": "a"}} {
+		if _, err := codec.Decode(RDKCompletionItem, data); err != ErrResolveDataTampered {
+			t.Errorf("%v: expected ErrResolveDataTampered, got %v", data, err)
+		}
+	}
+
+	// Data of the right kind that has been signed with another key is
+	// rejected as well.
+	foreign := newTestResolveDataCodec(t, []byte("fedcba9876543210"))
+	if _, err := foreign.Decode(RDKCompletionItem, throughClient(t, data)); err != ErrResolveDataTampered {
+		t.Errorf("expected foreign data to be rejected, got %v", err)
+	}
+}
+
+func TestResolveDataStale(t *testing.T) {
+	codec := newTestResolveDataCodec(t, testResolveDataKey)
+
+	data, err := codec.Encode(RDKCompletionItem, testResolveData{Symbol: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec.Invalidate()
+	if _, err := codec.Decode(RDKCompletionItem, throughClient(t, data)); err != ErrResolveDataStale {
+		t.Errorf("expected invalidated data to be stale, got %v", err)
+	}
+
+	data, err = codec.Encode(RDKCompletionItem, testResolveData{Symbol: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := codec.Decode(RDKCompletionItem, throughClient(t, data)); err != nil {
+		t.Errorf("expected data of the current generation to be accepted, got %v", err)
+	}
+
+	codec.MaxAge = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := codec.Decode(RDKCompletionItem, throughClient(t, data)); err != ErrResolveDataStale {
+		t.Errorf("expected expired data to be stale, got %v", err)
+	}
+}
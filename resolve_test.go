@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompletionItemResolver(t *testing.T) {
+	tests := []struct {
+		capabilities string
+		eager        []string
+		lazy         []string
+	}{
+		{"", []string{"documentation", "detail"}, nil},
+		{`{}`, []string{"documentation", "detail"}, nil},
+		{`{"completionItem": {"resolveSupport": {"properties": ["documentation"]}}}`, []string{"detail"}, []string{"documentation"}},
+	}
+
+	for _, test := range tests {
+		var capabilities *CompletionClientCapabilities
+		if test.capabilities != "" {
+			capabilities = &CompletionClientCapabilities{}
+			if err := json.Unmarshal([]byte(test.capabilities), capabilities); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var eager, lazy []string
+		resolver := NewCompletionItemResolver(capabilities, []string{"documentation", "detail"}, func(item *CompletionItem, properties []string) error {
+			if item.Detail == "" {
+				eager = append(eager, properties...)
+			} else {
+				lazy = append(lazy, properties...)
+			}
+
+			return nil
+		})
+
+		if err := resolver.Prepare([]CompletionItem{{}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := resolver.Resolve(CompletionItem{Detail: "cheap"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(eager, test.eager) || !reflect.DeepEqual(lazy, test.lazy) {
+			t.Errorf("%s: expected %v eagerly and %v lazily, got %v and %v", test.capabilities, test.eager, test.lazy, eager, lazy)
+		}
+
+		if resolver.ResolveProvider() != (len(test.lazy) > 0) {
+			t.Errorf("%s: unexpected resolve provider %v", test.capabilities, resolver.ResolveProvider())
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ProgressCollector routes the `$/progress` notifications a server sends to
+// the requests they belong to. It's used when acting as the client: every
+// request that should report progress or partial results is started with
+// `Start`, which hands out the tokens to attach to its parameters.
+//
+// A ProgressCollector is safe for concurrent use.
+type ProgressCollector struct {
+	mu      sync.Mutex
+	streams map[ProgressToken]*ResultStream
+	counter uint64
+}
+
+// NewProgressCollector instantiates a ProgressCollector.
+func NewProgressCollector() *ProgressCollector {
+	return &ProgressCollector{
+		streams: map[ProgressToken]*ResultStream{},
+	}
+}
+
+// Start creates a stream for a request. The prototype is a value of the type
+// partial results of the request are decoded into, like `[]Location{}` or
+// `SemanticTokens{}`. If it's nil, the stream only collects work done progress.
+//
+// Semantic tokens are always decoded as `SemanticTokens`, and deltas as
+// `SemanticTokensDelta`, even if the prototype is one of their partial
+// results. This way, the result ID carried by the first batch isn't lost.
+func (collector *ProgressCollector) Start(prototype interface{}) *ResultStream {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.counter++
+	id := strconv.FormatUint(collector.counter, 10)
+
+	stream := &ResultStream{
+		collector:     collector,
+		workDoneToken: ProgressToken("work-done-" + id),
+		signal:        make(chan struct{}, 1),
+	}
+
+	collector.streams[stream.workDoneToken] = stream
+
+	if prototype != nil {
+		stream.batchType = partialResultTypeOf(prototype)
+		stream.partialResultToken = ProgressToken("partial-result-" + id)
+		collector.streams[stream.partialResultToken] = stream
+	}
+
+	return stream
+}
+
+// HandleProgress handles a `$/progress` notification. It returns false if the
+// token doesn't belong to any active stream.
+func (collector *ProgressCollector) HandleProgress(params *ProgressParams) (bool, error) {
+	collector.mu.Lock()
+	stream, ok := collector.streams[params.Token]
+	collector.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	// The value is usually decoded into generic maps, so it's encoded again
+	// and decoded into the right type.
+	raw, err := json.Marshal(params.Value)
+	if err != nil {
+		return true, err
+	}
+
+	var event ResultStreamEvent
+	if params.Token == stream.partialResultToken {
+		batch := reflect.New(stream.batchType)
+		if err := json.Unmarshal(raw, batch.Interface()); err != nil {
+			return true, fmt.Errorf("could not decode partial result: %v", err)
+		}
+
+		event.PartialResult = batch.Elem().Interface()
+	} else {
+		progress, err := decodeWorkDoneProgress(raw)
+		if err != nil {
+			return true, err
+		}
+
+		event.Progress = progress
+	}
+
+	return true, stream.push(event)
+}
+
+// decodeWorkDoneProgress decodes a work done progress payload into a
+// `*WorkDoneProgressBegin`, `*WorkDoneProgressReport` or `*WorkDoneProgressEnd`
+// based on its kind.
+func decodeWorkDoneProgress(raw json.RawMessage) (interface{}, error) {
+	var header struct {
+		Kind string `json:"kind"`
+	}
+
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch header.Kind {
+	case "begin":
+		value = &WorkDoneProgressBegin{}
+	case "report":
+		value = &WorkDoneProgressReport{}
+	case "end":
+		value = &WorkDoneProgressEnd{}
+	default:
+		return nil, fmt.Errorf("unknown work done progress kind %q", header.Kind)
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// ResultStreamEvent is an event received for a request. Exactly one of its
+// fields is set.
+type ResultStreamEvent struct {
+	// A partial result, of the type of the prototype the stream was started
+	// with.
+	PartialResult interface{}
+
+	// A work done progress payload, which is a `*WorkDoneProgressBegin`,
+	// `*WorkDoneProgressReport` or `*WorkDoneProgressEnd`.
+	Progress interface{}
+}
+
+// ResultStream collects the progress and partial results of a single request.
+// Events are read with `Next` while the request is running, and the partial
+// results are merged with the final response with `Finish`.
+//
+// A ResultStream is safe for concurrent use.
+type ResultStream struct {
+	collector          *ProgressCollector
+	workDoneToken      ProgressToken
+	partialResultToken ProgressToken
+	batchType          reflect.Type
+
+	mu       sync.Mutex
+	events   []ResultStreamEvent
+	result   interface{}
+	finished bool
+	signal   chan struct{}
+}
+
+// WorkDoneToken returns the token to send as the `workDoneToken` of the
+// request.
+func (stream *ResultStream) WorkDoneToken() ProgressToken {
+	return stream.workDoneToken
+}
+
+// PartialResultToken returns the token to send as the `partialResultToken` of
+// the request. It's empty if the stream doesn't collect partial results.
+func (stream *ResultStream) PartialResultToken() ProgressToken {
+	return stream.partialResultToken
+}
+
+// Next returns the next event of the request. It blocks until an event comes
+// in, and returns false once the stream has been finished and all events have
+// been read, or when the context is done.
+func (stream *ResultStream) Next(ctx context.Context) (ResultStreamEvent, bool) {
+	for {
+		stream.mu.Lock()
+		if len(stream.events) > 0 {
+			event := stream.events[0]
+			stream.events = stream.events[1:]
+			stream.mu.Unlock()
+
+			return event, true
+		}
+
+		finished := stream.finished
+		stream.mu.Unlock()
+
+		if finished {
+			return ResultStreamEvent{}, false
+		}
+
+		select {
+		case <-stream.signal:
+		case <-ctx.Done():
+			return ResultStreamEvent{}, false
+		}
+	}
+}
+
+// Finish ends the stream once the response of the request has arrived, and
+// returns the partial results merged with the final response, as described
+// for `MergePartialResults`. The final response is a decoded value, not a
+// pointer to one, and may be nil. Events that have been received but not read
+// yet can still be read with `Next`.
+func (stream *ResultStream) Finish(final interface{}) (interface{}, error) {
+	stream.collector.mu.Lock()
+	delete(stream.collector.streams, stream.workDoneToken)
+	if stream.partialResultToken != "" {
+		delete(stream.collector.streams, stream.partialResultToken)
+	}
+	stream.collector.mu.Unlock()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.finished {
+		return nil, fmt.Errorf("result stream has already been finished")
+	}
+
+	stream.finished = true
+	stream.wake()
+
+	return MergePartialResults(stream.result, final)
+}
+
+// push adds an event to the stream, merging partial results as they come in.
+func (stream *ResultStream) push(event ResultStreamEvent) error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.finished {
+		return nil
+	}
+
+	if event.PartialResult != nil {
+		result, err := MergePartialResults(stream.result, event.PartialResult)
+		if err != nil {
+			return err
+		}
+
+		stream.result = result
+	}
+
+	stream.events = append(stream.events, event)
+	stream.wake()
+
+	return nil
+}
+
+// wake signals a waiting call to `Next`. It has to be called with the lock
+// held.
+func (stream *ResultStream) wake() {
+	select {
+	case stream.signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestResultStreamSemanticTokens(t *testing.T) {
+	for _, prototype := range []interface{}{SemanticTokens{}, SemanticTokensPartialResult{}} {
+		collector := NewProgressCollector()
+		stream := collector.Start(prototype)
+
+		values := []interface{}{
+			map[string]interface{}{"resultId": "1", "data": []uint{0, 0, 3, 0, 0}},
+			map[string]interface{}{"data": []uint{1, 0, 3, 0, 0}},
+		}
+
+		for _, value := range values {
+			handled, err := collector.HandleProgress(&ProgressParams{Token: stream.PartialResultToken(), Value: value})
+			if !handled || err != nil {
+				t.Fatalf("%T: partial result hasn't been handled: %v", prototype, err)
+			}
+		}
+
+		if _, err := stream.Finish(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var result interface{}
+		for {
+			event, ok := stream.Next(context.Background())
+			if !ok {
+				break
+			}
+
+			if result, _ = MergePartialResults(result, event.PartialResult); result == nil {
+				t.Fatalf("%T: unexpected event %+v", prototype, event)
+			}
+		}
+
+		expected := &SemanticTokens{ResultID: "1", Data: []uint{0, 0, 3, 0, 0, 1, 0, 3, 0, 0}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%T: expected %+v, got %+v", prototype, expected, result)
+		}
+	}
+}
+
+func TestResultStreamFinish(t *testing.T) {
+	collector := NewProgressCollector()
+	stream := collector.Start([]Location{})
+
+	value := []interface{}{map[string]interface{}{"uri": "file:///a"}}
+	if _, err := collector.HandleProgress(&ProgressParams{Token: stream.PartialResultToken(), Value: value}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := stream.Finish([]Location{{URI: "file:///b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Location{{URI: "file:///a"}, {URI: "file:///b"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+
+	if handled, _ := collector.HandleProgress(&ProgressParams{Token: stream.PartialResultToken(), Value: value}); handled {
+		t.Error("progress of a finished stream has been handled")
+	}
+}
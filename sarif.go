@@ -0,0 +1,410 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SARIFVersion is the version of the SARIF format written by
+// `DiagnosticsToSARIF`.
+const SARIFVersion = "2.1.0"
+
+// SARIFSchema is the JSON schema of the SARIF format written by
+// `DiagnosticsToSARIF`.
+const SARIFSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// SARIFLog is the root object of a SARIF file. Only the parts of the format
+// that have an equivalent in the protocol are modeled.
+type SARIFLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema,omitempty"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun contains the results of a single run of an analysis tool.
+type SARIFRun struct {
+	Tool SARIFTool `json:"tool"`
+
+	// The unit columns are measured in, either `utf16CodeUnits` (the default)
+	// or `unicodeCodePoints`.
+	ColumnKind string `json:"columnKind,omitempty"`
+
+	// The locations relative URIs are resolved against, by base ID.
+	OriginalURIBaseIDs map[string]SARIFArtifactLocation `json:"originalUriBaseIds,omitempty"`
+
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the analysis tool of a run.
+type SARIFTool struct {
+	Driver SARIFToolComponent `json:"driver"`
+}
+
+// SARIFToolComponent describes the tool, along with the rules it checks.
+type SARIFToolComponent struct {
+	Name           string                     `json:"name"`
+	Version        string                     `json:"version,omitempty"`
+	InformationURI string                     `json:"informationUri,omitempty"`
+	Rules          []SARIFReportingDescriptor `json:"rules,omitempty"`
+}
+
+// SARIFReportingDescriptor describes a rule.
+type SARIFReportingDescriptor struct {
+	ID               string        `json:"id"`
+	ShortDescription *SARIFMessage `json:"shortDescription,omitempty"`
+	HelpURI          string        `json:"helpUri,omitempty"`
+}
+
+// SARIFResult is a single finding, the equivalent of a diagnostic.
+type SARIFResult struct {
+	RuleID           string                 `json:"ruleId,omitempty"`
+	RuleIndex        *int                   `json:"ruleIndex,omitempty"`
+	Level            string                 `json:"level,omitempty"`
+	Message          SARIFMessage           `json:"message"`
+	Locations        []SARIFLocation        `json:"locations,omitempty"`
+	RelatedLocations []SARIFLocation        `json:"relatedLocations,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+// SARIFMessage is a plain text message.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFLocation is a location within an artifact, with an optional message.
+type SARIFLocation struct {
+	PhysicalLocation *SARIFPhysicalLocation `json:"physicalLocation,omitempty"`
+	Message          *SARIFMessage          `json:"message,omitempty"`
+}
+
+// SARIFPhysicalLocation is a region within an artifact.
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           *SARIFRegion          `json:"region,omitempty"`
+}
+
+// SARIFArtifactLocation identifies an artifact, like a file. The URI can be
+// relative to the location identified by the base ID.
+type SARIFArtifactLocation struct {
+	URI       string `json:"uri,omitempty"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// SARIFRegion is a text region. Lines and columns are one-based, and the end
+// column points just past the end of the region.
+type SARIFRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// DiagnosticsToSARIF converts published diagnostics into a SARIF log. One run
+// is created per diagnostic source; diagnostics without a source are
+// attributed to defaultTool. The diagnostic's code becomes the rule ID, and its
+// code description the rule's help URI. Tags are stored in the `tags` property
+// of a result.
+func DiagnosticsToSARIF(params []PublishDiagnosticsParams, defaultTool string) *SARIFLog {
+	type run struct {
+		run   *SARIFRun
+		rules map[string]int
+	}
+
+	runs := map[string]*run{}
+	tools := []string{}
+
+	for _, document := range params {
+		for _, diagnostic := range document.Diagnostics {
+			tool := diagnostic.Source
+			if tool == "" {
+				tool = defaultTool
+			}
+
+			current, ok := runs[tool]
+			if !ok {
+				current = &run{
+					run: &SARIFRun{
+						Tool:       SARIFTool{Driver: SARIFToolComponent{Name: tool}},
+						ColumnKind: "utf16CodeUnits",
+						Results:    []SARIFResult{},
+					},
+					rules: map[string]int{},
+				}
+
+				runs[tool] = current
+				tools = append(tools, tool)
+			}
+
+			result := SARIFResult{
+				RuleID:  diagnostic.Code,
+				Level:   sarifLevelOf(diagnostic.Severity),
+				Message: SARIFMessage{Text: diagnostic.Message},
+				Locations: []SARIFLocation{
+					sarifLocationOf(Location{URI: document.URI, Range: diagnostic.Range}, ""),
+				},
+			}
+
+			if diagnostic.Code != "" {
+				index, ok := current.rules[diagnostic.Code]
+				if !ok {
+					rule := SARIFReportingDescriptor{ID: diagnostic.Code}
+					if diagnostic.CodeDescription != nil {
+						rule.HelpURI = string(diagnostic.CodeDescription.Href)
+					}
+
+					index = len(current.run.Tool.Driver.Rules)
+					current.rules[diagnostic.Code] = index
+					current.run.Tool.Driver.Rules = append(current.run.Tool.Driver.Rules, rule)
+				}
+
+				result.RuleIndex = &index
+			}
+
+			for _, related := range diagnostic.RelatedInformation {
+				result.RelatedLocations = append(result.RelatedLocations, sarifLocationOf(related.Location, related.Message))
+			}
+
+			if len(diagnostic.Tags) > 0 {
+				tags := make([]interface{}, len(diagnostic.Tags))
+				for i, tag := range diagnostic.Tags {
+					tags[i] = tag.String()
+				}
+
+				result.Properties = map[string]interface{}{"tags": tags}
+			}
+
+			current.run.Results = append(current.run.Results, result)
+		}
+	}
+
+	sort.Strings(tools)
+
+	log := &SARIFLog{
+		Version: SARIFVersion,
+		Schema:  SARIFSchema,
+		Runs:    []SARIFRun{},
+	}
+
+	for _, tool := range tools {
+		log.Runs = append(log.Runs, *runs[tool].run)
+	}
+
+	return log
+}
+
+// SARIFToDiagnostics converts the results of a SARIF log into diagnostics,
+// grouped by document. Relative artifact URIs are resolved against the base
+// URIs declared in the run, or against base if the run declares none. Results
+// without a location are skipped.
+//
+// Columns measured in Unicode code points are taken as they are, which is only
+// exact for text within the Basic Multilingual Plane. Regions follow the
+// defaults of SARIF: a region without an end line ends on its start line, a
+// missing start column denotes the start of the line, and a missing end column
+// the end of the line. Since the length of the line is unknown, the latter is
+// expressed as the start of the next line.
+func SARIFToDiagnostics(log *SARIFLog, base DocumentURI) ([]PublishDiagnosticsParams, error) {
+	documents := map[DocumentURI][]Diagnostic{}
+
+	for i, run := range log.Runs {
+		for j, result := range run.Results {
+			if len(result.Locations) == 0 || result.Locations[0].PhysicalLocation == nil {
+				continue
+			}
+
+			location, err := locationOfSARIF(run, result.Locations[0], base)
+			if err != nil {
+				return nil, fmt.Errorf("run %d, result %d: %v", i, j, err)
+			}
+
+			diagnostic := Diagnostic{
+				Range:    location.Range,
+				Severity: severityOfSARIF(result.Level),
+				Code:     result.RuleID,
+				Source:   run.Tool.Driver.Name,
+				Message:  result.Message.Text,
+			}
+
+			if result.RuleIndex != nil && *result.RuleIndex >= 0 && *result.RuleIndex < len(run.Tool.Driver.Rules) {
+				rule := run.Tool.Driver.Rules[*result.RuleIndex]
+				if diagnostic.Code == "" {
+					diagnostic.Code = rule.ID
+				}
+
+				if rule.HelpURI != "" {
+					diagnostic.CodeDescription = &CodeDescription{Href: URI(rule.HelpURI)}
+				}
+			} else if diagnostic.Code != "" {
+				for _, rule := range run.Tool.Driver.Rules {
+					if rule.ID == diagnostic.Code && rule.HelpURI != "" {
+						diagnostic.CodeDescription = &CodeDescription{Href: URI(rule.HelpURI)}
+						break
+					}
+				}
+			}
+
+			for _, related := range result.RelatedLocations {
+				if related.PhysicalLocation == nil {
+					continue
+				}
+
+				relatedLocation, err := locationOfSARIF(run, related, base)
+				if err != nil {
+					return nil, fmt.Errorf("run %d, result %d: %v", i, j, err)
+				}
+
+				information := DiagnosticRelatedInformation{Location: relatedLocation}
+				if related.Message != nil {
+					information.Message = related.Message.Text
+				}
+
+				diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, information)
+			}
+
+			if tags, ok := result.Properties["tags"].([]interface{}); ok {
+				for _, tag := range tags {
+					switch tag {
+					case DTUnnecessary.String():
+						diagnostic.Tags = append(diagnostic.Tags, DTUnnecessary)
+					case DTDeprecated.String():
+						diagnostic.Tags = append(diagnostic.Tags, DTDeprecated)
+					}
+				}
+			}
+
+			documents[location.URI] = append(documents[location.URI], diagnostic)
+		}
+	}
+
+	uris := make([]string, 0, len(documents))
+	for uri := range documents {
+		uris = append(uris, string(uri))
+	}
+
+	sort.Strings(uris)
+
+	params := make([]PublishDiagnosticsParams, len(uris))
+	for i, uri := range uris {
+		params[i] = PublishDiagnosticsParams{
+			URI:         DocumentURI(uri),
+			Diagnostics: documents[DocumentURI(uri)],
+		}
+	}
+
+	return params, nil
+}
+
+// sarifLevelOf maps a diagnostic severity to a SARIF level.
+func sarifLevelOf(severity DiagnosticSeverity) string {
+	switch severity {
+	case DSError:
+		return "error"
+	case DSWarning:
+		return "warning"
+	case DSInformation:
+		return "note"
+	case DSHint:
+		return "none"
+	}
+
+	return ""
+}
+
+// severityOfSARIF maps a SARIF level to a diagnostic severity. A missing level
+// means `warning` in SARIF.
+func severityOfSARIF(level string) DiagnosticSeverity {
+	switch level {
+	case "error":
+		return DSError
+	case "note":
+		return DSInformation
+	case "none":
+		return DSHint
+	}
+
+	return DSWarning
+}
+
+// sarifLocationOf converts a location into a SARIF location.
+func sarifLocationOf(location Location, message string) SARIFLocation {
+	result := SARIFLocation{
+		PhysicalLocation: &SARIFPhysicalLocation{
+			ArtifactLocation: SARIFArtifactLocation{URI: string(location.URI)},
+			Region: &SARIFRegion{
+				StartLine:   location.Range.Start.Line + 1,
+				StartColumn: location.Range.Start.Character + 1,
+				EndLine:     location.Range.End.Line + 1,
+				EndColumn:   location.Range.End.Character + 1,
+			},
+		},
+	}
+
+	if message != "" {
+		result.Message = &SARIFMessage{Text: message}
+	}
+
+	return result
+}
+
+// locationOfSARIF converts a SARIF location into a location, resolving its
+// URI.
+func locationOfSARIF(run SARIFRun, location SARIFLocation, base DocumentURI) (Location, error) {
+	physical := location.PhysicalLocation
+
+	uri, err := resolveSARIFArtifact(run, physical.ArtifactLocation, base, 0)
+	if err != nil {
+		return Location{}, err
+	}
+
+	result := Location{URI: uri}
+
+	if region := physical.Region; region != nil && region.StartLine > 0 {
+		result.Range.Start.Line = region.StartLine - 1
+		if region.StartColumn > 0 {
+			result.Range.Start.Character = region.StartColumn - 1
+		}
+
+		endLine := region.EndLine
+		if endLine < region.StartLine {
+			endLine = region.StartLine
+		}
+
+		if region.EndColumn > 0 {
+			result.Range.End = Position{Line: endLine - 1, Character: region.EndColumn - 1}
+		} else {
+			result.Range.End = Position{Line: endLine}
+		}
+	}
+
+	return result, nil
+}
+
+// resolveSARIFArtifact resolves the URI of an artifact against its base ID.
+func resolveSARIFArtifact(run SARIFRun, artifact SARIFArtifactLocation, base DocumentURI, depth int) (DocumentURI, error) {
+	if _, err := ParseURI(artifact.URI); err == nil {
+		return DocumentURI(artifact.URI), nil
+	}
+
+	if depth > 8 {
+		return "", fmt.Errorf("base ID %q is defined recursively", artifact.URIBaseID)
+	}
+
+	root := base
+	if artifact.URIBaseID != "" {
+		if baseLocation, ok := run.OriginalURIBaseIDs[artifact.URIBaseID]; ok {
+			resolved, err := resolveSARIFArtifact(run, baseLocation, base, depth+1)
+			if err != nil {
+				return "", err
+			}
+
+			root = resolved
+		}
+	}
+
+	if root == "" {
+		return "", fmt.Errorf("%q is relative and has no base", artifact.URI)
+	}
+
+	return root.Join(strings.Split(unescapeURIComponent(artifact.URI), "/")...), nil
+}
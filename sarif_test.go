@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSARIFRoundTrip(t *testing.T) {
+	params := []PublishDiagnosticsParams{
+		{
+			URI: "file:///src/a.go",
+			Diagnostics: []Diagnostic{
+				{
+					Range:           Range{Start: Position{Line: 2, Character: 4}, End: Position{Line: 2, Character: 9}},
+					Severity:        DSError,
+					Code:            "SA4006",
+					CodeDescription: &CodeDescription{Href: "https://staticcheck.io/docs/checks#SA4006"},
+					Source:          "staticcheck",
+					Message:         "value is never used",
+					Tags:            []DiagnosticTag{DTUnnecessary},
+					RelatedInformation: []DiagnosticRelatedInformation{
+						{
+							Location: Location{URI: "file:///src/b.go", Range: Range{Start: Position{Line: 1}, End: Position{Line: 1, Character: 3}}},
+							Message:  "assigned here",
+						},
+					},
+				},
+				{
+					Range:    Range{Start: Position{Line: 0}, End: Position{Line: 1}},
+					Severity: DSHint,
+					Source:   "vet",
+					Message:  "whole line",
+				},
+			},
+		},
+		{
+			URI: "file:///src/b.go",
+			Diagnostics: []Diagnostic{
+				{
+					Range:           Range{Start: Position{Line: 5, Character: 1}, End: Position{Line: 7, Character: 2}},
+					Severity:        DSWarning,
+					Code:            "SA4006",
+					CodeDescription: &CodeDescription{Href: "https://staticcheck.io/docs/checks#SA4006"},
+					Source:          "staticcheck",
+					Message:         "value is never used",
+				},
+			},
+		},
+	}
+
+	encoded, err := json.Marshal(DiagnosticsToSARIF(params, "default"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := &SARIFLog{}
+	if err := json.Unmarshal(encoded, log); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(log.Runs) != 2 || len(log.Runs[0].Tool.Driver.Rules) != 1 {
+		t.Errorf("expected one run per source and one rule per code, got %s", encoded)
+	}
+
+	decoded, err := SARIFToDiagnostics(log, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, params) {
+		t.Errorf("expected %+v, got %+v", params, decoded)
+	}
+}
+
+func TestSARIFRegionDefaults(t *testing.T) {
+	tests := []struct {
+		region   *SARIFRegion
+		expected Range
+	}{
+		{
+			&SARIFRegion{StartLine: 3},
+			Range{Start: Position{Line: 2}, End: Position{Line: 3}},
+		},
+		{
+			&SARIFRegion{StartLine: 3, StartColumn: 5},
+			Range{Start: Position{Line: 2, Character: 4}, End: Position{Line: 3}},
+		},
+		{
+			&SARIFRegion{StartLine: 3, EndLine: 5},
+			Range{Start: Position{Line: 2}, End: Position{Line: 5}},
+		},
+		{
+			&SARIFRegion{StartLine: 3, StartColumn: 2, EndColumn: 6},
+			Range{Start: Position{Line: 2, Character: 1}, End: Position{Line: 2, Character: 5}},
+		},
+		{
+			&SARIFRegion{StartLine: 3, EndLine: 4, EndColumn: 2},
+			Range{Start: Position{Line: 2}, End: Position{Line: 3, Character: 1}},
+		},
+		{
+			nil,
+			Range{},
+		},
+	}
+
+	for _, test := range tests {
+		log := &SARIFLog{
+			Version: SARIFVersion,
+			Runs: []SARIFRun{
+				{
+					Tool: SARIFTool{Driver: SARIFToolComponent{Name: "tool"}},
+					OriginalURIBaseIDs: map[string]SARIFArtifactLocation{
+						"SRCROOT": {URI: "file:///src/"},
+					},
+					Results: []SARIFResult{
+						{
+							Message: SARIFMessage{Text: "finding"},
+							Locations: []SARIFLocation{
+								{
+									PhysicalLocation: &SARIFPhysicalLocation{
+										ArtifactLocation: SARIFArtifactLocation{URI: "a%20b.go", URIBaseID: "SRCROOT"},
+										Region:           test.region,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		params, err := SARIFToDiagnostics(log, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(params) != 1 || params[0].URI != "file:///src/a%20b.go" || len(params[0].Diagnostics) != 1 {
+			t.Fatalf("%+v: unexpected diagnostics %+v", test.region, params)
+		}
+
+		if got := params[0].Diagnostics[0].Range; got != test.expected {
+			t.Errorf("%+v: expected %+v, got %+v", test.region, test.expected, got)
+		}
+	}
+}
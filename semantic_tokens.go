@@ -165,10 +165,14 @@ type SemanticTokensOptions struct {
 	Range bool `json:"range,omitempty"`
 
 	// Server supports providing semantic tokens for a full document.
-	Full struct {
-		// The server supports deltas for full documents.
-		Delta bool `json:"delta,omitempty"`
-	} `json:"full,omitempty"`
+	Full *SemanticTokensFullOptions `json:"full,omitempty"`
+}
+
+// SemanticTokensFullOptions specifies the options for providing semantic tokens
+// for a full document.
+type SemanticTokensFullOptions struct {
+	// The server supports deltas for full documents.
+	Delta bool `json:"delta,omitempty"`
 }
 
 // SemanticTokensRegistrationOptions describes options to be used when
@@ -0,0 +1,344 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultSemanticTokenFallbacks maps standard token types to more generic
+// standard types. It's used by `NewSemanticTokensAdapter` when a client doesn't
+// support a token type and no custom fallback is defined for it. Fallbacks are
+// followed until a type the client supports is found.
+var DefaultSemanticTokenFallbacks = map[SemanticTokenType]SemanticTokenType{
+	STTClass:         STTType,
+	STTEnum:          STTType,
+	STTInterface:     STTType,
+	STTStruct:        STTClass,
+	STTTypeParameter: STTType,
+	STTParameter:     STTVariable,
+	STTProperty:      STTVariable,
+	STTEnumMember:    STTProperty,
+	STTEvent:         STTProperty,
+	STTMethod:        STTFunction,
+	STTMacro:         STTFunction,
+	STTModifier:      STTKeyword,
+	STTRegExp:        STTString,
+	STTOperator:      STTKeyword,
+}
+
+// SemanticTokensAdapter adapts the semantic tokens produced by a server to the
+// capabilities of a client. It negotiates a legend that only holds the token
+// types and modifiers the client supports, maps unsupported token types to
+// supported ones and rewrites tokens the client can't handle:
+//
+//   - Tokens spanning multiple lines are split into one token per line, unless
+//     the client supports multiline tokens.
+//   - Overlapping tokens are cut so that the innermost token wins, unless the
+//     client supports overlapping tokens.
+type SemanticTokensAdapter struct {
+	legend      SemanticTokensLegend
+	types       map[SemanticTokenType]SemanticTokenType
+	modifiers   map[SemanticTokenModifiers]bool
+	multiline   bool
+	overlapping bool
+}
+
+// NewSemanticTokensAdapter instantiates a SemanticTokensAdapter for the legend
+// preferred by the server and the capabilities of the client. The fallbacks
+// map custom or standard token types to the types that should be used instead
+// if the client doesn't support them; `DefaultSemanticTokenFallbacks` is used
+// for types that have no entry in fallbacks. Tokens whose type can't be mapped
+// to any supported type are dropped.
+//
+// If client is nil, the server's legend is used as-is, and the client is
+// assumed to support neither multiline nor overlapping tokens.
+func NewSemanticTokensAdapter(server SemanticTokensLegend, client *SemanticTokensClientCapabilities, fallbacks map[SemanticTokenType]SemanticTokenType) *SemanticTokensAdapter {
+	adapter := &SemanticTokensAdapter{
+		types:     map[SemanticTokenType]SemanticTokenType{},
+		modifiers: map[SemanticTokenModifiers]bool{},
+	}
+
+	supportedTypes := map[SemanticTokenType]bool{}
+	supportedModifiers := map[SemanticTokenModifiers]bool{}
+
+	if client == nil {
+		for _, tokenType := range server.TokenTypes {
+			supportedTypes[tokenType] = true
+		}
+
+		for _, modifier := range server.TokenModifiers {
+			supportedModifiers[modifier] = true
+		}
+	} else {
+		for _, tokenType := range client.TokenTypes {
+			supportedTypes[tokenType] = true
+		}
+
+		for _, modifier := range client.TokenModifiers {
+			supportedModifiers[modifier] = true
+		}
+
+		adapter.multiline = client.MultilineTokenSupport
+		adapter.overlapping = client.OverlappingTokenSupport
+	}
+
+	inLegend := map[SemanticTokenType]bool{}
+	adapter.legend.TokenTypes = []SemanticTokenType{}
+
+	for _, tokenType := range server.TokenTypes {
+		resolved, ok := resolveSemanticTokenType(tokenType, supportedTypes, fallbacks)
+		if !ok {
+			continue
+		}
+
+		adapter.types[tokenType] = resolved
+		if !inLegend[resolved] {
+			inLegend[resolved] = true
+			adapter.legend.TokenTypes = append(adapter.legend.TokenTypes, resolved)
+		}
+	}
+
+	adapter.legend.TokenModifiers = []SemanticTokenModifiers{}
+	for _, modifier := range server.TokenModifiers {
+		if supportedModifiers[modifier] && !adapter.modifiers[modifier] {
+			adapter.modifiers[modifier] = true
+			adapter.legend.TokenModifiers = append(adapter.legend.TokenModifiers, modifier)
+		}
+	}
+
+	return adapter
+}
+
+// resolveSemanticTokenType follows the fallbacks of a token type until a type
+// the client supports is found.
+func resolveSemanticTokenType(tokenType SemanticTokenType, supported map[SemanticTokenType]bool, fallbacks map[SemanticTokenType]SemanticTokenType) (SemanticTokenType, bool) {
+	visited := map[SemanticTokenType]bool{}
+
+	for !supported[tokenType] {
+		if visited[tokenType] {
+			return "", false
+		}
+
+		visited[tokenType] = true
+
+		next, ok := fallbacks[tokenType]
+		if !ok {
+			next, ok = DefaultSemanticTokenFallbacks[tokenType]
+		}
+
+		if !ok {
+			return "", false
+		}
+
+		tokenType = next
+	}
+
+	return tokenType, true
+}
+
+// Legend returns the negotiated legend. It's the legend that has to be
+// advertised in the `SemanticTokensOptions` of the server.
+func (adapter *SemanticTokensAdapter) Legend() SemanticTokensLegend {
+	return adapter.legend
+}
+
+// Adapt rewrites a list of tokens to fit the client's capabilities. The text
+// of the document is needed to split multiline tokens; the length of such a
+// token includes the line terminators it spans. The returned tokens are sorted
+// by their position.
+func (adapter *SemanticTokensAdapter) Adapt(tokens []SemanticToken, text string) []SemanticToken {
+	result := make([]SemanticToken, 0, len(tokens))
+
+	for _, token := range tokens {
+		tokenType, ok := adapter.types[token.TokenType]
+		if !ok {
+			continue
+		}
+
+		token.TokenType = tokenType
+
+		var modifiers []SemanticTokenModifiers
+		for _, modifier := range token.TokenModifiers {
+			if adapter.modifiers[modifier] {
+				modifiers = append(modifiers, modifier)
+			}
+		}
+
+		token.TokenModifiers = modifiers
+		result = append(result, token)
+	}
+
+	if !adapter.multiline {
+		result = splitMultilineTokens(result, text)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Line != result[j].Line {
+			return result[i].Line < result[j].Line
+		}
+
+		return result[i].StartChar < result[j].StartChar
+	})
+
+	if !adapter.overlapping {
+		result = resolveOverlappingTokens(result)
+	}
+
+	return result
+}
+
+// Encode adapts the tokens and encodes them using the negotiated legend.
+func (adapter *SemanticTokensAdapter) Encode(tokens []SemanticToken, text string) ([]uint, error) {
+	return EncodeSemanticTokens(adapter.Adapt(tokens, text), adapter.legend)
+}
+
+// splitMultilineTokens splits every token that exceeds the end of its line
+// into one token per line. Tokens are left untouched if the text is empty.
+func splitMultilineTokens(tokens []SemanticToken, text string) []SemanticToken {
+	if text == "" {
+		return tokens
+	}
+
+	type line struct {
+		length     uint
+		terminator uint
+	}
+
+	lines := []line{}
+	for _, content := range strings.SplitAfter(text, "\n") {
+		terminator := uint(0)
+		if strings.HasSuffix(content, "\r\n") {
+			terminator = 2
+		} else if strings.HasSuffix(content, "\n") {
+			terminator = 1
+		}
+
+		lines = append(lines, line{
+			length:     uint(utf16Length(content)) - terminator,
+			terminator: terminator,
+		})
+	}
+
+	result := make([]SemanticToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Line >= uint(len(lines)) || token.StartChar+token.Length <= lines[token.Line].length {
+			result = append(result, token)
+			continue
+		}
+
+		remaining := token.Length
+		start := token.StartChar
+		for current := token.Line; remaining > 0 && current < uint(len(lines)); current++ {
+			available := uint(0)
+			if start < lines[current].length {
+				available = lines[current].length - start
+			}
+
+			length := available
+			if remaining < length {
+				length = remaining
+			}
+
+			if length > 0 {
+				piece := token
+				piece.Line = current
+				piece.StartChar = start
+				piece.Length = length
+				result = append(result, piece)
+			}
+
+			remaining -= length
+			if remaining <= lines[current].terminator {
+				break
+			}
+
+			remaining -= lines[current].terminator
+			start = 0
+		}
+	}
+
+	return result
+}
+
+// resolveOverlappingTokens cuts overlapping tokens so that no two tokens
+// overlap anymore. Where tokens overlap, the one that starts last wins, and
+// among those the shortest one. The tokens have to be sorted by position.
+func resolveOverlappingTokens(tokens []SemanticToken) []SemanticToken {
+	result := make([]SemanticToken, 0, len(tokens))
+
+	for start := 0; start < len(tokens); {
+		end := start + 1
+		for end < len(tokens) && tokens[end].Line == tokens[start].Line {
+			end++
+		}
+
+		result = append(result, resolveOverlappingLine(tokens[start:end])...)
+		start = end
+	}
+
+	return result
+}
+
+// resolveOverlappingLine resolves the overlapping tokens on a single line.
+func resolveOverlappingLine(tokens []SemanticToken) []SemanticToken {
+	overlapping := false
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i].StartChar < tokens[i-1].StartChar+tokens[i-1].Length {
+			overlapping = true
+			break
+		}
+	}
+
+	if !overlapping {
+		return tokens
+	}
+
+	boundaries := make([]uint, 0, len(tokens)*2)
+	for _, token := range tokens {
+		boundaries = append(boundaries, token.StartChar, token.StartChar+token.Length)
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i] < boundaries[j]
+	})
+
+	result := []SemanticToken{}
+	last := -1
+
+	for i := 0; i+1 < len(boundaries); i++ {
+		from, to := boundaries[i], boundaries[i+1]
+		if from == to {
+			continue
+		}
+
+		winner := -1
+		for j, token := range tokens {
+			if token.StartChar > from || token.StartChar+token.Length < to {
+				continue
+			}
+
+			if winner < 0 || token.StartChar > tokens[winner].StartChar ||
+				(token.StartChar == tokens[winner].StartChar && token.Length <= tokens[winner].Length) {
+				winner = j
+			}
+		}
+
+		if winner < 0 {
+			last = -1
+			continue
+		}
+
+		if winner == last {
+			result[len(result)-1].Length += to - from
+			continue
+		}
+
+		piece := tokens[winner]
+		piece.StartChar = from
+		piece.Length = to - from
+		result = append(result, piece)
+		last = winner
+	}
+
+	return result
+}
@@ -0,0 +1,192 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticTokensAdapterLegend(t *testing.T) {
+	server := SemanticTokensLegend{
+		TokenTypes: []SemanticTokenType{
+			STTNamespace, STTStruct, STTMethod, STTParameter, "customMacro", STTComment, STTClass,
+		},
+		TokenModifiers: []SemanticTokenModifiers{STMDeclaration, STMReadOnly, STMStatic},
+	}
+
+	client := &SemanticTokensClientCapabilities{
+		TokenTypes:     []SemanticTokenType{STTVariable, STTFunction, STTClass, STTNamespace},
+		TokenModifiers: []SemanticTokenModifiers{STMStatic, STMDeclaration, STMAsync},
+	}
+
+	adapter := NewSemanticTokensAdapter(server, client, map[SemanticTokenType]SemanticTokenType{
+		"customMacro": STTMacro,
+	})
+
+	expected := SemanticTokensLegend{
+		TokenTypes:     []SemanticTokenType{STTNamespace, STTClass, STTFunction, STTVariable},
+		TokenModifiers: []SemanticTokenModifiers{STMDeclaration, STMStatic},
+	}
+
+	if legend := adapter.Legend(); !reflect.DeepEqual(legend, expected) {
+		t.Errorf("expected legend %+v, got %+v", expected, legend)
+	}
+
+	tokens := adapter.Adapt([]SemanticToken{
+		{Line: 0, StartChar: 0, Length: 3, TokenType: STTStruct, TokenModifiers: []SemanticTokenModifiers{STMDeclaration, STMReadOnly}},
+		{Line: 0, StartChar: 4, Length: 3, TokenType: STTComment},
+		{Line: 0, StartChar: 8, Length: 3, TokenType: "customMacro"},
+		{Line: 0, StartChar: 12, Length: 3, TokenType: STTParameter, TokenModifiers: []SemanticTokenModifiers{STMReadOnly}},
+	}, "")
+
+	expectedTokens := []SemanticToken{
+		{Line: 0, StartChar: 0, Length: 3, TokenType: STTClass, TokenModifiers: []SemanticTokenModifiers{STMDeclaration}},
+		{Line: 0, StartChar: 8, Length: 3, TokenType: STTFunction},
+		{Line: 0, StartChar: 12, Length: 3, TokenType: STTVariable},
+	}
+
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("expected tokens %+v, got %+v", expectedTokens, tokens)
+	}
+}
+
+func TestSemanticTokensAdapterMultiline(t *testing.T) {
+	text := "abc\r\ndefgh\nij"
+
+	tests := []struct {
+		name     string
+		client   *SemanticTokensClientCapabilities
+		tokens   []SemanticToken
+		expected []SemanticToken
+	}{
+		{
+			"single line",
+			nil,
+			[]SemanticToken{{Line: 1, StartChar: 1, Length: 3, TokenType: STTType}},
+			[]SemanticToken{{Line: 1, StartChar: 1, Length: 3, TokenType: STTType}},
+		},
+		{
+			"into the line terminator",
+			nil,
+			[]SemanticToken{{Line: 0, StartChar: 1, Length: 3, TokenType: STTType}},
+			[]SemanticToken{{Line: 0, StartChar: 1, Length: 2, TokenType: STTType}},
+		},
+		{
+			"across a CRLF terminator",
+			nil,
+			[]SemanticToken{{Line: 0, StartChar: 1, Length: 7, TokenType: STTType}},
+			[]SemanticToken{
+				{Line: 0, StartChar: 1, Length: 2, TokenType: STTType},
+				{Line: 1, StartChar: 0, Length: 3, TokenType: STTType},
+			},
+		},
+		{
+			"across an LF terminator",
+			nil,
+			[]SemanticToken{{Line: 1, StartChar: 3, Length: 5, TokenType: STTType}},
+			[]SemanticToken{
+				{Line: 1, StartChar: 3, Length: 2, TokenType: STTType},
+				{Line: 2, StartChar: 0, Length: 2, TokenType: STTType},
+			},
+		},
+		{
+			"across all lines",
+			nil,
+			[]SemanticToken{{Line: 0, StartChar: 0, Length: 13, TokenType: STTType}},
+			[]SemanticToken{
+				{Line: 0, StartChar: 0, Length: 3, TokenType: STTType},
+				{Line: 1, StartChar: 0, Length: 5, TokenType: STTType},
+				{Line: 2, StartChar: 0, Length: 2, TokenType: STTType},
+			},
+		},
+		{
+			"past the end of the text",
+			nil,
+			[]SemanticToken{{Line: 5, StartChar: 0, Length: 4, TokenType: STTType}},
+			[]SemanticToken{{Line: 5, StartChar: 0, Length: 4, TokenType: STTType}},
+		},
+		{
+			"multiline support",
+			&SemanticTokensClientCapabilities{
+				TokenTypes:            []SemanticTokenType{STTType},
+				MultilineTokenSupport: true,
+			},
+			[]SemanticToken{{Line: 0, StartChar: 1, Length: 7, TokenType: STTType}},
+			[]SemanticToken{{Line: 0, StartChar: 1, Length: 7, TokenType: STTType}},
+		},
+	}
+
+	for _, test := range tests {
+		adapter := NewSemanticTokensAdapter(testSemanticTokensLegend, test.client, nil)
+
+		if tokens := adapter.Adapt(test.tokens, text); !reflect.DeepEqual(tokens, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, tokens)
+		}
+	}
+}
+
+func TestSemanticTokensAdapterOverlapping(t *testing.T) {
+	token := func(line, startChar, length uint, tokenType SemanticTokenType) SemanticToken {
+		return SemanticToken{Line: line, StartChar: startChar, Length: length, TokenType: tokenType}
+	}
+
+	tests := []struct {
+		name     string
+		client   *SemanticTokensClientCapabilities
+		tokens   []SemanticToken
+		expected []SemanticToken
+	}{
+		{
+			"disjoint tokens are sorted",
+			nil,
+			[]SemanticToken{token(1, 0, 2, STTType), token(0, 4, 2, STTVariable), token(0, 0, 2, STTProperty)},
+			[]SemanticToken{token(0, 0, 2, STTProperty), token(0, 4, 2, STTVariable), token(1, 0, 2, STTType)},
+		},
+		{
+			"nested token",
+			nil,
+			[]SemanticToken{token(0, 0, 10, STTType), token(0, 2, 3, STTVariable)},
+			[]SemanticToken{token(0, 0, 2, STTType), token(0, 2, 3, STTVariable), token(0, 5, 5, STTType)},
+		},
+		{
+			"same start",
+			nil,
+			[]SemanticToken{token(0, 0, 5, STTType), token(0, 0, 3, STTVariable)},
+			[]SemanticToken{token(0, 0, 3, STTVariable), token(0, 3, 2, STTType)},
+		},
+		{
+			"partial overlap",
+			nil,
+			[]SemanticToken{token(0, 0, 4, STTType), token(0, 2, 4, STTVariable)},
+			[]SemanticToken{token(0, 0, 2, STTType), token(0, 2, 4, STTVariable)},
+		},
+		{
+			"deeply nested tokens",
+			nil,
+			[]SemanticToken{token(0, 0, 9, STTNamespace), token(0, 1, 7, STTType), token(0, 3, 2, STTVariable)},
+			[]SemanticToken{
+				token(0, 0, 1, STTNamespace),
+				token(0, 1, 2, STTType),
+				token(0, 3, 2, STTVariable),
+				token(0, 5, 3, STTType),
+				token(0, 8, 1, STTNamespace),
+			},
+		},
+		{
+			"overlapping support",
+			&SemanticTokensClientCapabilities{
+				TokenTypes:              []SemanticTokenType{STTType, STTVariable},
+				OverlappingTokenSupport: true,
+			},
+			[]SemanticToken{token(0, 2, 3, STTVariable), token(0, 0, 10, STTType)},
+			[]SemanticToken{token(0, 0, 10, STTType), token(0, 2, 3, STTVariable)},
+		},
+	}
+
+	for _, test := range tests {
+		adapter := NewSemanticTokensAdapter(testSemanticTokensLegend, test.client, nil)
+
+		if tokens := adapter.Adapt(test.tokens, ""); !reflect.DeepEqual(tokens, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, tokens)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SemanticToken is a single semantic token with an absolute position. It's the
+// decoded form of the five integers a token takes up in `SemanticTokens.Data`.
+type SemanticToken struct {
+	// The zero-based line the token is located on.
+	Line uint
+
+	// The zero-based character offset the token starts at. Like all character
+	// offsets in the protocol it's expressed in UTF-16 code units.
+	StartChar uint
+
+	// The length of the token in UTF-16 code units.
+	Length uint
+
+	// The type of the token.
+	TokenType SemanticTokenType
+
+	// The modifiers applied to the token.
+	TokenModifiers []SemanticTokenModifiers
+}
+
+// SemanticTokensBuilder collects semantic tokens in any order and encodes them
+// into the relative format used by `SemanticTokens.Data`.
+type SemanticTokensBuilder struct {
+	legend SemanticTokensLegend
+	tokens []SemanticToken
+}
+
+// NewSemanticTokensBuilder instantiates a SemanticTokensBuilder that resolves
+// token types and modifiers against the given legend.
+func NewSemanticTokensBuilder(legend SemanticTokensLegend) *SemanticTokensBuilder {
+	return &SemanticTokensBuilder{legend: legend}
+}
+
+// Push adds a token to the builder.
+func (builder *SemanticTokensBuilder) Push(line, startChar, length uint, tokenType SemanticTokenType, tokenModifiers []SemanticTokenModifiers) {
+	builder.tokens = append(builder.tokens, SemanticToken{
+		Line:           line,
+		StartChar:      startChar,
+		Length:         length,
+		TokenType:      tokenType,
+		TokenModifiers: tokenModifiers,
+	})
+}
+
+// Tokens returns the tokens pushed so far, in the order they were pushed in.
+func (builder *SemanticTokensBuilder) Tokens() []SemanticToken {
+	return builder.tokens
+}
+
+// Reset removes all tokens from the builder, so it can be reused.
+func (builder *SemanticTokensBuilder) Reset() {
+	builder.tokens = nil
+}
+
+// Build encodes the pushed tokens. The returned result has no result ID.
+func (builder *SemanticTokensBuilder) Build() (SemanticTokens, error) {
+	data, err := EncodeSemanticTokens(builder.tokens, builder.legend)
+	if err != nil {
+		return SemanticTokens{}, err
+	}
+
+	return SemanticTokens{Data: data}, nil
+}
+
+// EncodeSemanticTokens sorts tokens by their position and encodes them into the
+// relative format used by `SemanticTokens.Data`. It fails if a token uses a
+// type or a modifier that isn't part of the legend.
+func EncodeSemanticTokens(tokens []SemanticToken, legend SemanticTokensLegend) ([]uint, error) {
+	types := make(map[SemanticTokenType]uint, len(legend.TokenTypes))
+	for i, tokenType := range legend.TokenTypes {
+		if _, ok := types[tokenType]; !ok {
+			types[tokenType] = uint(i)
+		}
+	}
+
+	modifiers := make(map[SemanticTokenModifiers]uint, len(legend.TokenModifiers))
+	for i, modifier := range legend.TokenModifiers {
+		if _, ok := modifiers[modifier]; !ok {
+			modifiers[modifier] = uint(i)
+		}
+	}
+
+	sorted := make([]SemanticToken, len(tokens))
+	copy(sorted, tokens)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Line != sorted[j].Line {
+			return sorted[i].Line < sorted[j].Line
+		}
+
+		return sorted[i].StartChar < sorted[j].StartChar
+	})
+
+	data := make([]uint, 0, len(sorted)*5)
+
+	var line, startChar uint
+	for _, token := range sorted {
+		tokenType, ok := types[token.TokenType]
+		if !ok {
+			return nil, fmt.Errorf("token type %q is not part of the legend", token.TokenType)
+		}
+
+		var bitset uint
+		for _, modifier := range token.TokenModifiers {
+			index, ok := modifiers[modifier]
+			if !ok {
+				return nil, fmt.Errorf("token modifier %q is not part of the legend", modifier)
+			}
+
+			if index >= 32 {
+				return nil, fmt.Errorf("token modifier %q doesn't fit into the modifier bitset", modifier)
+			}
+
+			bitset |= 1 << index
+		}
+
+		deltaStart := token.StartChar
+		if token.Line == line {
+			deltaStart -= startChar
+		}
+
+		data = append(data, token.Line-line, deltaStart, token.Length, tokenType, bitset)
+		line, startChar = token.Line, token.StartChar
+	}
+
+	return data, nil
+}
+
+// DecodeSemanticTokens decodes the relative format used by
+// `SemanticTokens.Data` into a list of tokens with absolute positions.
+func DecodeSemanticTokens(data []uint, legend SemanticTokensLegend) ([]SemanticToken, error) {
+	if len(data)%5 != 0 {
+		return nil, fmt.Errorf("semantic tokens data has a length of %d, which is not a multiple of 5", len(data))
+	}
+
+	tokens := make([]SemanticToken, 0, len(data)/5)
+
+	var line, startChar uint
+	for i := 0; i < len(data); i += 5 {
+		deltaLine, deltaStart, length, tokenType, bitset := data[i], data[i+1], data[i+2], data[i+3], data[i+4]
+
+		if deltaLine > 0 {
+			line += deltaLine
+			startChar = deltaStart
+		} else {
+			startChar += deltaStart
+		}
+
+		if tokenType >= uint(len(legend.TokenTypes)) {
+			return nil, fmt.Errorf("token %d has type index %d, which is not part of the legend", i/5, tokenType)
+		}
+
+		token := SemanticToken{
+			Line:      line,
+			StartChar: startChar,
+			Length:    length,
+			TokenType: legend.TokenTypes[tokenType],
+		}
+
+		for index := uint(0); bitset != 0; index++ {
+			if bitset&1 != 0 {
+				if index >= uint(len(legend.TokenModifiers)) {
+					return nil, fmt.Errorf("token %d has modifier index %d, which is not part of the legend", i/5, index)
+				}
+
+				token.TokenModifiers = append(token.TokenModifiers, legend.TokenModifiers[index])
+			}
+
+			bitset >>= 1
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var testSemanticTokensLegend = SemanticTokensLegend{
+	TokenTypes:     []SemanticTokenType{STTNamespace, STTType, STTVariable, STTProperty},
+	TokenModifiers: []SemanticTokenModifiers{STMDeclaration, STMReadOnly, STMStatic},
+}
+
+func TestSemanticTokensBuilder(t *testing.T) {
+	builder := NewSemanticTokensBuilder(testSemanticTokensLegend)
+	builder.Push(2, 5, 3, STTProperty, nil)
+	builder.Push(0, 4, 1, STTVariable, []SemanticTokenModifiers{STMDeclaration, STMStatic})
+	builder.Push(2, 1, 2, STTType, []SemanticTokenModifiers{STMReadOnly})
+
+	tokens, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint{
+		0, 4, 1, 2, 5,
+		2, 1, 2, 1, 2,
+		0, 4, 3, 3, 0,
+	}
+
+	if !reflect.DeepEqual(tokens.Data, expected) {
+		t.Errorf("expected %v, got %v", expected, tokens.Data)
+	}
+
+	builder.Push(0, 0, 1, STTEvent, nil)
+	if _, err := builder.Build(); err == nil {
+		t.Error("token type outside of the legend has been encoded")
+	}
+
+	builder.Reset()
+	builder.Push(0, 0, 1, STTType, []SemanticTokenModifiers{STMAsync})
+	if _, err := builder.Build(); err == nil {
+		t.Error("token modifier outside of the legend has been encoded")
+	}
+}
+
+func TestSemanticTokensRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		var tokens []SemanticToken
+
+		var line, startChar uint
+		for j := random.Intn(20); j > 0; j-- {
+			if random.Intn(3) == 0 {
+				line += uint(random.Intn(3) + 1)
+				startChar = 0
+			}
+
+			startChar += uint(random.Intn(10))
+
+			token := SemanticToken{
+				Line:      line,
+				StartChar: startChar,
+				Length:    uint(random.Intn(10) + 1),
+				TokenType: testSemanticTokensLegend.TokenTypes[random.Intn(len(testSemanticTokensLegend.TokenTypes))],
+			}
+
+			for _, modifier := range testSemanticTokensLegend.TokenModifiers {
+				if random.Intn(2) == 0 {
+					token.TokenModifiers = append(token.TokenModifiers, modifier)
+				}
+			}
+
+			tokens = append(tokens, token)
+			startChar += token.Length
+		}
+
+		data, err := EncodeSemanticTokens(tokens, testSemanticTokensLegend)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := DecodeSemanticTokens(data, testSemanticTokensLegend)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tokens) == 0 {
+			tokens = []SemanticToken{}
+		}
+
+		if !reflect.DeepEqual(decoded, tokens) {
+			t.Fatalf("expected %+v, got %+v", tokens, decoded)
+		}
+	}
+}
+
+func TestDecodeSemanticTokensErrors(t *testing.T) {
+	tests := [][]uint{
+		{0, 0, 1, 0},
+		{0, 0, 1, 4, 0},
+		{0, 0, 1, 0, 8},
+	}
+
+	for _, data := range tests {
+		if _, err := DecodeSemanticTokens(data, testSemanticTokensLegend); err == nil {
+			t.Errorf("%v: invalid data has been decoded", data)
+		}
+	}
+}
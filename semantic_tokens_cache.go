@@ -0,0 +1,171 @@
+package lsp
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// SemanticTokensCache remembers the last semantic tokens result sent for every
+// document, so that `textDocument/semanticTokens/full/delta` requests can be
+// answered with a delta instead of the full set of tokens.
+//
+// Only the most recent result of a document is kept, since that's the one the
+// client will refer to. The cache holds at most a fixed number of documents
+// and evicts the least recently used one when it's full. A SemanticTokensCache
+// is safe for concurrent use.
+type SemanticTokensCache struct {
+	mu sync.Mutex
+
+	capacity  int
+	documents map[DocumentURI]*list.Element
+	order     *list.List
+
+	lastID uint64
+}
+
+// semanticTokensCacheEntry is the cached result of a single document.
+type semanticTokensCacheEntry struct {
+	uri      DocumentURI
+	resultID string
+	data     []uint
+}
+
+// NewSemanticTokensCache instantiates a SemanticTokensCache that holds the
+// results of up to capacity documents. A capacity of zero or less means the
+// cache is unbounded.
+func NewSemanticTokensCache(capacity int) *SemanticTokensCache {
+	return &SemanticTokensCache{
+		capacity:  capacity,
+		documents: map[DocumentURI]*list.Element{},
+		order:     list.New(),
+	}
+}
+
+// Full stores the tokens of a document and returns them as the result of a
+// `textDocument/semanticTokens/full` request, along with a new result ID.
+func (cache *SemanticTokensCache) Full(uri DocumentURI, data []uint) SemanticTokens {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if data == nil {
+		data = []uint{}
+	}
+
+	return SemanticTokens{
+		ResultID: cache.store(uri, data),
+		Data:     data,
+	}
+}
+
+// Delta stores the tokens of a document and returns the result of a
+// `textDocument/semanticTokens/full/delta` request. The result is a
+// `SemanticTokensDelta` against the previous result if previousResultID refers
+// to the last result of the document, or a full `SemanticTokens` result if the
+// previous result is unknown or has been evicted.
+func (cache *SemanticTokensCache) Delta(uri DocumentURI, previousResultID string, data []uint) interface{} {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	var previous []uint
+	found := false
+
+	if element, ok := cache.documents[uri]; ok {
+		entry := element.Value.(*semanticTokensCacheEntry)
+		if entry.resultID == previousResultID {
+			previous = entry.data
+			found = true
+		}
+	}
+
+	if data == nil {
+		data = []uint{}
+	}
+
+	resultID := cache.store(uri, data)
+	if !found {
+		return SemanticTokens{
+			ResultID: resultID,
+			Data:     data,
+		}
+	}
+
+	return SemanticTokensDelta{
+		ResultID: resultID,
+		Edits:    ComputeSemanticTokensEdits(previous, data),
+	}
+}
+
+// Forget removes the cached result of a document, e.g. after it has been
+// closed.
+func (cache *SemanticTokensCache) Forget(uri DocumentURI) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.documents[uri]; ok {
+		cache.order.Remove(element)
+		delete(cache.documents, uri)
+	}
+}
+
+// store saves a copy of the tokens as the latest result of a document and
+// returns its new result ID.
+func (cache *SemanticTokensCache) store(uri DocumentURI, data []uint) string {
+	cache.lastID++
+	resultID := strconv.FormatUint(cache.lastID, 10)
+
+	entry := &semanticTokensCacheEntry{
+		uri:      uri,
+		resultID: resultID,
+		data:     append([]uint{}, data...),
+	}
+
+	if element, ok := cache.documents[uri]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return resultID
+	}
+
+	cache.documents[uri] = cache.order.PushFront(entry)
+
+	if cache.capacity > 0 && cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.documents, oldest.Value.(*semanticTokensCacheEntry).uri)
+	}
+
+	return resultID
+}
+
+// ComputeSemanticTokensEdits computes the edits that transform the encoded
+// tokens in previous into the ones in current. Since a change to a document
+// usually only affects the tokens around a single location, the common prefix
+// and suffix of both arrays are kept and the rest is replaced in a single
+// edit. No edits are returned if both arrays are equal.
+func ComputeSemanticTokensEdits(previous, current []uint) []SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(previous) && prefix < len(current) && previous[prefix] == current[prefix] {
+		prefix++
+	}
+
+	if prefix == len(previous) && prefix == len(current) {
+		return []SemanticTokensEdit{}
+	}
+
+	suffix := 0
+	for suffix < len(previous)-prefix && suffix < len(current)-prefix &&
+		previous[len(previous)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+
+	edit := SemanticTokensEdit{
+		Start:       uint(prefix),
+		DeleteCount: uint(len(previous) - prefix - suffix),
+	}
+
+	if inserted := current[prefix : len(current)-suffix]; len(inserted) > 0 {
+		edit.Data = append([]uint(nil), inserted...)
+	}
+
+	return []SemanticTokensEdit{edit}
+}
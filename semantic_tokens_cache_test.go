@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// applySemanticTokensEdits applies edits to encoded tokens, as a client would.
+func applySemanticTokensEdits(data []uint, edits []SemanticTokensEdit) []uint {
+	result := append([]uint{}, data...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		tail := append(append([]uint{}, edit.Data...), result[edit.Start+edit.DeleteCount:]...)
+		result = append(result[:edit.Start], tail...)
+	}
+
+	return result
+}
+
+func TestComputeSemanticTokensEditsRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomData := func() []uint {
+		data := make([]uint, random.Intn(6)*5)
+		for i := range data {
+			data[i] = uint(random.Intn(3))
+		}
+
+		return data
+	}
+
+	for i := 0; i < 1000; i++ {
+		previous, current := randomData(), randomData()
+
+		edits := ComputeSemanticTokensEdits(previous, current)
+		if result := applySemanticTokensEdits(previous, edits); !reflect.DeepEqual(result, current) {
+			t.Fatalf("%v -> %v: edits %+v result in %v", previous, current, edits, result)
+		}
+
+		if reflect.DeepEqual(previous, current) && len(edits) != 0 {
+			t.Errorf("%v: equal tokens result in edits %+v", previous, edits)
+		}
+	}
+}
+
+func TestSemanticTokensCacheDelta(t *testing.T) {
+	cache := NewSemanticTokensCache(0)
+
+	full := cache.Full("file:///a.go", []uint{0, 0, 3, 0, 0})
+
+	result := cache.Delta("file:///a.go", full.ResultID, []uint{0, 0, 3, 0, 0, 1, 0, 2, 1, 0})
+	delta, ok := result.(SemanticTokensDelta)
+	if !ok {
+		t.Fatalf("expected a delta, got %+v", result)
+	}
+
+	if delta.ResultID == full.ResultID {
+		t.Error("result ID hasn't changed")
+	}
+
+	expected := []SemanticTokensEdit{{Start: 5, Data: []uint{1, 0, 2, 1, 0}}}
+	if !reflect.DeepEqual(delta.Edits, expected) {
+		t.Errorf("expected %+v, got %+v", expected, delta.Edits)
+	}
+
+	// The first result ID has been replaced, so the full tokens are sent.
+	if result := cache.Delta("file:///a.go", full.ResultID, []uint{}); !reflect.DeepEqual(result, SemanticTokens{ResultID: "3", Data: []uint{}}) {
+		t.Errorf("expected full tokens, got %+v", result)
+	}
+
+	cache.Forget("file:///a.go")
+	if _, ok := cache.Delta("file:///a.go", "3", nil).(SemanticTokens); !ok {
+		t.Error("forgotten document has been answered with a delta")
+	}
+}
+
+func TestSemanticTokensCacheEviction(t *testing.T) {
+	cache := NewSemanticTokensCache(2)
+
+	a := cache.Full("file:///a.go", nil)
+	b := cache.Full("file:///b.go", nil)
+	cache.Full("file:///c.go", nil)
+
+	if _, ok := cache.Delta("file:///a.go", a.ResultID, nil).(SemanticTokens); !ok {
+		t.Error("evicted document has been answered with a delta")
+	}
+
+	// Storing a.go again evicted b.go, which was the least recently used.
+	if _, ok := cache.Delta("file:///b.go", b.ResultID, nil).(SemanticTokens); !ok {
+		t.Error("evicted document has been answered with a delta")
+	}
+}
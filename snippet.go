@@ -0,0 +1,636 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SnippetElement is an element of a parsed snippet. It can be one of
+// `*SnippetText`, `*SnippetTabstop`, `*SnippetPlaceholder`, `*SnippetChoice`
+// or `*SnippetVariable`.
+type SnippetElement interface {
+	// writeSnippet writes the element in snippet syntax.
+	writeSnippet(builder *strings.Builder)
+}
+
+// SnippetText is a piece of literal text in a snippet.
+type SnippetText struct {
+	// The unescaped text.
+	Value string
+}
+
+// SnippetTabstop is a tab stop, like `$1` or `${1}`. The tab stop `$0` marks
+// the final cursor position.
+type SnippetTabstop struct {
+	// The index of the tab stop.
+	Index int
+
+	// An optional transformation applied to the text typed at the tab stop.
+	Transform *SnippetTransform
+}
+
+// SnippetPlaceholder is a tab stop with a default value, like `${1:foo}`.
+// Placeholders can be nested, like `${1:foo ${2:bar}}`.
+type SnippetPlaceholder struct {
+	// The index of the placeholder.
+	Index int
+
+	// The default value of the placeholder.
+	Value []SnippetElement
+}
+
+// SnippetChoice is a tab stop that lets the user pick one of several values,
+// like `${1|one,two,three|}`.
+type SnippetChoice struct {
+	// The index of the choice.
+	Index int
+
+	// The values the user can choose from.
+	Options []string
+}
+
+// SnippetVariable is a variable that is resolved by the client, like
+// `$TM_FILENAME` or `${TM_FILENAME:default}`. If the client doesn't know the
+// variable, the default value is inserted, or the name of the variable if
+// there is no default value.
+type SnippetVariable struct {
+	// The name of the variable.
+	Name string
+
+	// The default value of the variable. It's nil if the variable has no
+	// default value.
+	Default []SnippetElement
+
+	// An optional transformation applied to the value of the variable.
+	Transform *SnippetTransform
+}
+
+// SnippetTransform is a regular expression based transformation, like
+// `/(.*)/${1:/upcase}/g`.
+type SnippetTransform struct {
+	// The regular expression, as written in the snippet.
+	Regex string
+
+	// The format string, as written in the snippet.
+	Format string
+
+	// The regular expression options, like `g` or `i`.
+	Options string
+}
+
+// Snippet is a parsed snippet.
+type Snippet struct {
+	Elements []SnippetElement
+}
+
+// ParseSnippet parses a string in snippet syntax, as used by completion items
+// whose insert text format is `ITFSnippet`.
+//
+// A `$` that doesn't start a tab stop, placeholder, choice or variable is
+// treated as literal text. Constructs that start with `${` but are malformed
+// are reported as an error.
+func ParseSnippet(text string) (*Snippet, error) {
+	parser := &snippetParser{text: text}
+
+	elements, err := parser.parseElements(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snippet{Elements: elements}, nil
+}
+
+// String returns the snippet in snippet syntax.
+func (snippet *Snippet) String() string {
+	var builder strings.Builder
+	writeSnippetElements(&builder, snippet.Elements)
+
+	return builder.String()
+}
+
+// PlainText renders the snippet as plain text, for clients that don't support
+// snippets. Tab stops are removed, placeholders are replaced by their default
+// values and choices by their first option. A tab stop that shares its index
+// with a placeholder is replaced by the placeholder's value, just like an
+// editor would mirror it.
+//
+// Variables are resolved from the given map. Unknown variables are replaced by
+// their default value, or by their name if they don't have one, which is what
+// editors do. Transformations are not applied.
+func (snippet *Snippet) PlainText(variables map[string]string) string {
+	renderer := &snippetRenderer{
+		variables: variables,
+		values:    map[int]string{},
+	}
+
+	renderer.collect(snippet.Elements)
+
+	var builder strings.Builder
+	renderer.render(&builder, snippet.Elements)
+
+	return builder.String()
+}
+
+// SnippetToPlainText parses a snippet and renders it as plain text. See
+// `Snippet.PlainText` for details.
+func SnippetToPlainText(text string) (string, error) {
+	snippet, err := ParseSnippet(text)
+	if err != nil {
+		return "", err
+	}
+
+	return snippet.PlainText(nil), nil
+}
+
+// PlainTextCompletionItem converts a completion item that uses a snippet into
+// one that uses plain text. It should be applied to completion items sent to
+// clients that don't advertise `snippetSupport`. Items that already use plain
+// text are returned unchanged.
+func PlainTextCompletionItem(item CompletionItem) (CompletionItem, error) {
+	if item.InsertTextFormat != ITFSnippet {
+		return item, nil
+	}
+
+	if item.InsertText != "" {
+		text, err := SnippetToPlainText(item.InsertText)
+		if err != nil {
+			return item, err
+		}
+
+		item.InsertText = text
+	}
+
+	if item.TextEdit != nil {
+		text, err := SnippetToPlainText(item.TextEdit.NewText)
+		if err != nil {
+			return item, err
+		}
+
+		edit := *item.TextEdit
+		edit.NewText = text
+		item.TextEdit = &edit
+	}
+
+	item.InsertTextFormat = ITFPlainText
+	return item, nil
+}
+
+// EscapeSnippetText escapes text so that it's inserted literally when used in
+// a snippet.
+func EscapeSnippetText(text string) string {
+	return snippetTextEscaper.Replace(text)
+}
+
+var snippetTextEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
+
+var snippetChoiceEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `|`, `\|`)
+
+func (element *SnippetText) writeSnippet(builder *strings.Builder) {
+	builder.WriteString(EscapeSnippetText(element.Value))
+}
+
+func (element *SnippetTabstop) writeSnippet(builder *strings.Builder) {
+	// The braces are always written, since `$1` followed by text starting
+	// with a digit would read as a different tab stop.
+	builder.WriteString("${" + strconv.Itoa(element.Index))
+	if element.Transform != nil {
+		element.Transform.writeSnippet(builder)
+	}
+
+	builder.WriteString("}")
+}
+
+func (element *SnippetPlaceholder) writeSnippet(builder *strings.Builder) {
+	builder.WriteString("${" + strconv.Itoa(element.Index) + ":")
+	writeSnippetElements(builder, element.Value)
+	builder.WriteString("}")
+}
+
+func (element *SnippetChoice) writeSnippet(builder *strings.Builder) {
+	options := make([]string, len(element.Options))
+	for i, option := range element.Options {
+		options[i] = snippetChoiceEscaper.Replace(option)
+	}
+
+	builder.WriteString("${" + strconv.Itoa(element.Index) + "|")
+	builder.WriteString(strings.Join(options, ","))
+	builder.WriteString("|}")
+}
+
+func (element *SnippetVariable) writeSnippet(builder *strings.Builder) {
+	if element.Default == nil && element.Transform == nil {
+		builder.WriteString("${" + element.Name + "}")
+		return
+	}
+
+	builder.WriteString("${" + element.Name)
+	if element.Transform != nil {
+		element.Transform.writeSnippet(builder)
+	} else {
+		builder.WriteString(":")
+		writeSnippetElements(builder, element.Default)
+	}
+
+	builder.WriteString("}")
+}
+
+func (transform *SnippetTransform) writeSnippet(builder *strings.Builder) {
+	builder.WriteString("/" + transform.Regex + "/" + transform.Format + "/" + transform.Options)
+}
+
+func writeSnippetElements(builder *strings.Builder, elements []SnippetElement) {
+	for _, element := range elements {
+		element.writeSnippet(builder)
+	}
+}
+
+// snippetRenderer renders snippets as plain text.
+type snippetRenderer struct {
+	variables map[string]string
+
+	// The rendered values of the placeholders, by index.
+	values map[int]string
+}
+
+// collect renders the value of every placeholder, so linked tab stops can be
+// replaced by it.
+func (renderer *snippetRenderer) collect(elements []SnippetElement) {
+	for _, element := range elements {
+		switch element := element.(type) {
+		case *SnippetPlaceholder:
+			renderer.collect(element.Value)
+
+			if _, ok := renderer.values[element.Index]; !ok {
+				var builder strings.Builder
+				renderer.render(&builder, element.Value)
+				renderer.values[element.Index] = builder.String()
+			}
+		case *SnippetChoice:
+			if _, ok := renderer.values[element.Index]; !ok && len(element.Options) > 0 {
+				renderer.values[element.Index] = element.Options[0]
+			}
+		case *SnippetVariable:
+			renderer.collect(element.Default)
+		}
+	}
+}
+
+func (renderer *snippetRenderer) render(builder *strings.Builder, elements []SnippetElement) {
+	for _, element := range elements {
+		switch element := element.(type) {
+		case *SnippetText:
+			builder.WriteString(element.Value)
+		case *SnippetTabstop:
+			builder.WriteString(renderer.values[element.Index])
+		case *SnippetPlaceholder:
+			renderer.render(builder, element.Value)
+		case *SnippetChoice:
+			if len(element.Options) > 0 {
+				builder.WriteString(element.Options[0])
+			}
+		case *SnippetVariable:
+			if value, ok := renderer.variables[element.Name]; ok {
+				builder.WriteString(value)
+			} else if element.Default != nil {
+				renderer.render(builder, element.Default)
+			} else {
+				builder.WriteString(element.Name)
+			}
+		}
+	}
+}
+
+// snippetParser is a recursive descent parser for the snippet syntax.
+type snippetParser struct {
+	text     string
+	position int
+}
+
+// parseElements parses elements until the end of the text or, if nested is
+// set, until an unescaped `}`.
+func (parser *snippetParser) parseElements(nested bool) ([]SnippetElement, error) {
+	elements := []SnippetElement{}
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			elements = append(elements, &SnippetText{Value: text.String()})
+			text.Reset()
+		}
+	}
+
+	for parser.position < len(parser.text) {
+		c := parser.text[parser.position]
+
+		switch {
+		case c == '\\' && parser.position+1 < len(parser.text) && strings.IndexByte(`\$}`, parser.text[parser.position+1]) >= 0:
+			text.WriteByte(parser.text[parser.position+1])
+			parser.position += 2
+		case c == '}' && nested:
+			flush()
+			return elements, nil
+		case c == '$':
+			element, err := parser.parseDollar()
+			if err != nil {
+				return nil, err
+			}
+
+			if element == nil {
+				text.WriteByte('$')
+				parser.position++
+				continue
+			}
+
+			flush()
+			elements = append(elements, element)
+		default:
+			text.WriteByte(c)
+			parser.position++
+		}
+	}
+
+	if nested {
+		return nil, parser.errorf("missing closing brace")
+	}
+
+	flush()
+	return elements, nil
+}
+
+// parseDollar parses a construct that starts with `$`. It returns nil if the
+// `$` should be treated as literal text.
+func (parser *snippetParser) parseDollar() (SnippetElement, error) {
+	start := parser.position
+	parser.position++
+
+	if index, ok := parser.parseInt(); ok {
+		return &SnippetTabstop{Index: index}, nil
+	}
+
+	if name, ok := parser.parseName(); ok {
+		return &SnippetVariable{Name: name}, nil
+	}
+
+	if !parser.consume('{') {
+		parser.position = start
+		return nil, nil
+	}
+
+	if index, ok := parser.parseInt(); ok {
+		switch {
+		case parser.consume('}'):
+			return &SnippetTabstop{Index: index}, nil
+		case parser.consume(':'):
+			value, err := parser.parseElements(true)
+			if err != nil {
+				return nil, err
+			}
+
+			parser.position++
+			return &SnippetPlaceholder{Index: index, Value: value}, nil
+		case parser.consume('|'):
+			options, err := parser.parseChoiceOptions()
+			if err != nil {
+				return nil, err
+			}
+
+			return &SnippetChoice{Index: index, Options: options}, nil
+		case parser.peek('/'):
+			transform, err := parser.parseTransform()
+			if err != nil {
+				return nil, err
+			}
+
+			return &SnippetTabstop{Index: index, Transform: transform}, nil
+		}
+
+		return nil, parser.errorf("unexpected character in tab stop")
+	}
+
+	if name, ok := parser.parseName(); ok {
+		switch {
+		case parser.consume('}'):
+			return &SnippetVariable{Name: name}, nil
+		case parser.consume(':'):
+			value, err := parser.parseElements(true)
+			if err != nil {
+				return nil, err
+			}
+
+			parser.position++
+			return &SnippetVariable{Name: name, Default: value}, nil
+		case parser.peek('/'):
+			transform, err := parser.parseTransform()
+			if err != nil {
+				return nil, err
+			}
+
+			return &SnippetVariable{Name: name, Transform: transform}, nil
+		}
+
+		return nil, parser.errorf("unexpected character in variable")
+	}
+
+	return nil, parser.errorf("expected a tab stop index or a variable name")
+}
+
+// parseChoiceOptions parses the options of a choice, up to and including the
+// closing `|}`.
+func (parser *snippetParser) parseChoiceOptions() ([]string, error) {
+	options := []string{}
+	var option strings.Builder
+
+	for parser.position < len(parser.text) {
+		c := parser.text[parser.position]
+
+		switch {
+		case c == '\\' && parser.position+1 < len(parser.text) && strings.IndexByte(`\,|`, parser.text[parser.position+1]) >= 0:
+			option.WriteByte(parser.text[parser.position+1])
+			parser.position += 2
+		case c == ',':
+			options = append(options, option.String())
+			option.Reset()
+			parser.position++
+		case c == '|':
+			if !strings.HasPrefix(parser.text[parser.position:], "|}") {
+				return nil, parser.errorf("expected `|}` at the end of a choice")
+			}
+
+			parser.position += 2
+			return append(options, option.String()), nil
+		default:
+			option.WriteByte(c)
+			parser.position++
+		}
+	}
+
+	return nil, parser.errorf("unterminated choice")
+}
+
+// parseTransform parses a transformation, up to and including the closing
+// `}` of the surrounding tab stop or variable.
+func (parser *snippetParser) parseTransform() (*SnippetTransform, error) {
+	parser.position++
+
+	regex, err := parser.parseTransformPart('/')
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := parser.parseTransformPart('/')
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := parser.parseTransformPart('}')
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnippetTransform{Regex: regex, Format: format, Options: options}, nil
+}
+
+// parseTransformPart reads raw text up to the given unescaped delimiter, which
+// is consumed. Format strings can contain `${...}` constructs, so braces are
+// balanced when looking for the closing brace.
+func (parser *snippetParser) parseTransformPart(delimiter byte) (string, error) {
+	start := parser.position
+	depth := 0
+
+	for parser.position < len(parser.text) {
+		c := parser.text[parser.position]
+
+		switch {
+		case c == '\\' && parser.position+1 < len(parser.text):
+			parser.position += 2
+			continue
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == delimiter && depth == 0:
+			part := parser.text[start:parser.position]
+			parser.position++
+			return part, nil
+		}
+
+		parser.position++
+	}
+
+	return "", parser.errorf("unterminated transformation")
+}
+
+// parseInt parses a non-negative integer.
+func (parser *snippetParser) parseInt() (int, bool) {
+	start := parser.position
+	for parser.position < len(parser.text) && parser.text[parser.position] >= '0' && parser.text[parser.position] <= '9' {
+		parser.position++
+	}
+
+	if start == parser.position {
+		return 0, false
+	}
+
+	index, err := strconv.Atoi(parser.text[start:parser.position])
+	if err != nil {
+		parser.position = start
+		return 0, false
+	}
+
+	return index, true
+}
+
+// parseName parses a variable name.
+func (parser *snippetParser) parseName() (string, bool) {
+	start := parser.position
+	for parser.position < len(parser.text) {
+		c := parser.text[parser.position]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(parser.position > start && c >= '0' && c <= '9') {
+			parser.position++
+			continue
+		}
+
+		break
+	}
+
+	return parser.text[start:parser.position], start != parser.position
+}
+
+func (parser *snippetParser) peek(c byte) bool {
+	return parser.position < len(parser.text) && parser.text[parser.position] == c
+}
+
+func (parser *snippetParser) consume(c byte) bool {
+	if parser.peek(c) {
+		parser.position++
+		return true
+	}
+
+	return false
+}
+
+func (parser *snippetParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("snippet: %s at offset %d", fmt.Sprintf(format, args...), parser.position)
+}
+
+// SnippetBuilder builds a snippet string, taking care of escaping.
+type SnippetBuilder struct {
+	builder strings.Builder
+}
+
+// NewSnippetBuilder instantiates a SnippetBuilder.
+func NewSnippetBuilder() *SnippetBuilder {
+	return &SnippetBuilder{}
+}
+
+// Text appends literal text.
+func (builder *SnippetBuilder) Text(text string) *SnippetBuilder {
+	builder.builder.WriteString(EscapeSnippetText(text))
+	return builder
+}
+
+// Tabstop appends a tab stop.
+func (builder *SnippetBuilder) Tabstop(index int) *SnippetBuilder {
+	(&SnippetTabstop{Index: index}).writeSnippet(&builder.builder)
+	return builder
+}
+
+// FinalTabstop appends the final tab stop, `${0}`.
+func (builder *SnippetBuilder) FinalTabstop() *SnippetBuilder {
+	return builder.Tabstop(0)
+}
+
+// Placeholder appends a placeholder with the given literal default value.
+func (builder *SnippetBuilder) Placeholder(index int, value string) *SnippetBuilder {
+	(&SnippetPlaceholder{
+		Index: index,
+		Value: []SnippetElement{&SnippetText{Value: value}},
+	}).writeSnippet(&builder.builder)
+
+	return builder
+}
+
+// Choice appends a choice between the given options.
+func (builder *SnippetBuilder) Choice(index int, options ...string) *SnippetBuilder {
+	(&SnippetChoice{Index: index, Options: options}).writeSnippet(&builder.builder)
+	return builder
+}
+
+// Variable appends a variable with the given literal default value. If the
+// default value is empty, the variable is written without one.
+func (builder *SnippetBuilder) Variable(name, defaultValue string) *SnippetBuilder {
+	variable := &SnippetVariable{Name: name}
+	if defaultValue != "" {
+		variable.Default = []SnippetElement{&SnippetText{Value: defaultValue}}
+	}
+
+	variable.writeSnippet(&builder.builder)
+	return builder
+}
+
+// String returns the snippet built so far.
+func (builder *SnippetBuilder) String() string {
+	return builder.builder.String()
+}
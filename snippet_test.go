@@ -0,0 +1,83 @@
+package lsp
+
+import "testing"
+
+func TestSnippetBuilderDigitAfterTabstop(t *testing.T) {
+	text := NewSnippetBuilder().Tabstop(1).Text("2").FinalTabstop().String()
+
+	snippet, err := ParseSnippet(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snippet.Elements) != 3 {
+		t.Fatalf("expected 3 elements in %q, got %d", text, len(snippet.Elements))
+	}
+
+	if tabstop, ok := snippet.Elements[0].(*SnippetTabstop); !ok || tabstop.Index != 1 {
+		t.Errorf("expected tab stop 1 in %q, got %#v", text, snippet.Elements[0])
+	}
+}
+
+func TestSnippetRoundTrip(t *testing.T) {
+	tests := []string{
+		"foo",
+		"${1}2",
+		"${1:name} = ${2|a,b\\,c|}${0}",
+		"${TM_FILENAME/(.*)\\..+$/$1/}",
+		"${1:outer ${2:inner}} \\$ \\}",
+		"${TM_SELECTED_TEXT:${1:default}}",
+	}
+
+	for _, test := range tests {
+		snippet, err := ParseSnippet(test)
+		if err != nil {
+			t.Errorf("%q: %v", test, err)
+			continue
+		}
+
+		reparsed, err := ParseSnippet(snippet.String())
+		if err != nil {
+			t.Errorf("%q: %v", snippet.String(), err)
+			continue
+		}
+
+		if reparsed.String() != snippet.String() {
+			t.Errorf("%q: %q doesn't round trip, got %q", test, snippet.String(), reparsed.String())
+		}
+	}
+}
+
+func TestSnippetPlainText(t *testing.T) {
+	tests := []struct {
+		snippet  string
+		expected string
+	}{
+		{"func ${1:name}() { $1 }$0", "func name() { name }"},
+		{"${1|one,two|}", "one"},
+		{"$UNKNOWN", "UNKNOWN"},
+		{"${UNKNOWN:fallback}", "fallback"},
+		{"${KNOWN}", "value"},
+		{"\\$1 \\}", "$1 }"},
+	}
+
+	for _, test := range tests {
+		snippet, err := ParseSnippet(test.snippet)
+		if err != nil {
+			t.Errorf("%q: %v", test.snippet, err)
+			continue
+		}
+
+		if got := snippet.PlainText(map[string]string{"KNOWN": "value"}); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.snippet, test.expected, got)
+		}
+	}
+}
+
+func TestParseSnippetErrors(t *testing.T) {
+	for _, test := range []string{"${1:unterminated", "${1|a,b}", "${/x/}"} {
+		if _, err := ParseSnippet(test); err == nil {
+			t.Errorf("%q: expected an error", test)
+		}
+	}
+}
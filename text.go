@@ -0,0 +1,158 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ApplyTextEdits applies a set of text edits to text and returns the result.
+// All ranges are interpreted relative to the original text, just like in a
+// `TextDocumentEdit`. Edits that start at the same position are applied in the
+// order they appear in. Overlapping edits are reported as an error.
+func ApplyTextEdits(text string, edits []TextEdit) (string, error) {
+	if len(edits) == 0 {
+		return text, nil
+	}
+
+	index := newLineIndex(text)
+
+	type span struct {
+		start, end int
+		newText    string
+	}
+
+	spans := make([]span, len(edits))
+	for i, edit := range edits {
+		start, end := index.offset(edit.Range.Start), index.offset(edit.Range.End)
+		if end < start {
+			return "", fmt.Errorf("text edit %d has an invalid range", i)
+		}
+
+		spans[i] = span{start: start, end: end, newText: edit.NewText}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var builder strings.Builder
+	last := 0
+	for i, span := range spans {
+		if span.start < last {
+			return "", fmt.Errorf("text edit %d overlaps with a previous edit", i)
+		}
+
+		builder.WriteString(text[last:span.start])
+		builder.WriteString(span.newText)
+		last = span.end
+	}
+
+	builder.WriteString(text[last:])
+	return builder.String(), nil
+}
+
+// lineIndex converts between byte offsets in a text and LSP positions.
+type lineIndex struct {
+	text  string
+	lines []int
+}
+
+// newLineIndex indexes the lines of a text. As in the specification, `\n`,
+// `\r\n` and `\r` are line terminators.
+func newLineIndex(text string) *lineIndex {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if length := lineBreakLength(text, i); length > 0 {
+			i += length - 1
+			lines = append(lines, i+1)
+		}
+	}
+
+	return &lineIndex{text: text, lines: lines}
+}
+
+// lineBreakLength returns the length in bytes of the line terminator at the
+// given offset, or 0 if there is none.
+func lineBreakLength(text string, offset int) int {
+	switch text[offset] {
+	case '\n':
+		return 1
+	case '\r':
+		if offset+1 < len(text) && text[offset+1] == '\n' {
+			return 2
+		}
+
+		return 1
+	}
+
+	return 0
+}
+
+// position returns the position of the given byte offset. The character offset
+// is counted in UTF-16 code units.
+func (index *lineIndex) position(offset int) Position {
+	line := sort.Search(len(index.lines), func(i int) bool {
+		return index.lines[i] > offset
+	}) - 1
+
+	return Position{
+		Line:      line,
+		Character: utf16Length(index.text[index.lines[line]:offset]),
+	}
+}
+
+// offset returns the byte offset of the given position. Positions past the end
+// of a line are clamped to the end of the line, positions past the end of the
+// document are clamped to the end of the document.
+func (index *lineIndex) offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+
+	if position.Line >= len(index.lines) {
+		return len(index.text)
+	}
+
+	start := index.lines[position.Line]
+	end := len(index.text)
+	if position.Line+1 < len(index.lines) {
+		// Every line but the last one ends with a terminator, which isn't
+		// part of the line.
+		end = index.lines[position.Line+1] - 1
+		if end > start && index.text[end-1] == '\r' && index.text[end] == '\n' {
+			end--
+		}
+	}
+
+	line := index.text[start:end]
+
+	units := 0
+	for i, r := range line {
+		if units >= position.Character {
+			return start + i
+		}
+
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+
+	return start + len(line)
+}
+
+// utf16Length returns the number of UTF-16 code units needed to encode text.
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+
+	return length
+}
@@ -0,0 +1,326 @@
+package lsp
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// PathStyle defines the flavor of file system paths a URI is converted from or
+// to.
+type PathStyle int
+
+const (
+	// PSPOSIX denotes slash separated paths, like `/home/user/file.go`.
+	PSPOSIX PathStyle = iota + 1
+
+	// PSWindows denotes backslash separated paths with drive letters or UNC
+	// shares, like `C:\Users\user\file.go` or `\\server\share\file.go`.
+	PSWindows
+)
+
+func (style PathStyle) String() string {
+	switch style {
+	case PSPOSIX:
+		return "posix"
+	case PSWindows:
+		return "windows"
+	}
+
+	return "<unknown>"
+}
+
+// NativePathStyle is the path style of the operating system the program runs
+// on.
+var NativePathStyle = nativePathStyle()
+
+func nativePathStyle() PathStyle {
+	if runtime.GOOS == "windows" {
+		return PSWindows
+	}
+
+	return PSPOSIX
+}
+
+// ParsedURI is a URI split into its components. All components are stored
+// without percent-encoding.
+type ParsedURI struct {
+	// The scheme, like `file` or `untitled`.
+	Scheme string
+
+	// The authority, like the host of a UNC path. Empty for local files.
+	Authority string
+
+	// The path, always slash separated. Windows drive letters are part of the
+	// path, like in `/c:/file.go`.
+	Path string
+
+	// The query, without the leading `?`.
+	Query string
+
+	// The fragment, without the leading `#`.
+	Fragment string
+}
+
+// uriPattern splits a URI into its components, as described in RFC 3986.
+var uriPattern = regexp.MustCompile(`^(([^:/?#]+?):)?(//([^/?#]*))?([^?#]*)(\?([^#]*))?(#(.*))?$`)
+
+// drivePattern matches a path that starts with a Windows drive letter, with or
+// without a leading slash.
+var drivePattern = regexp.MustCompile(`^/?[a-zA-Z]:(/|$)`)
+
+// ParseURI splits a URI into its components and removes their
+// percent-encoding. Invalid escape sequences are kept as they are. It fails if
+// the URI has no scheme.
+func ParseURI(uri string) (ParsedURI, error) {
+	match := uriPattern.FindStringSubmatch(uri)
+	if match == nil || match[2] == "" {
+		return ParsedURI{}, fmt.Errorf("%q is not a valid URI: missing scheme", uri)
+	}
+
+	return ParsedURI{
+		Scheme:    match[2],
+		Authority: unescapeURIComponent(match[4]),
+		Path:      unescapeURIComponent(match[5]),
+		Query:     unescapeURIComponent(match[7]),
+		Fragment:  unescapeURIComponent(match[9]),
+	}, nil
+}
+
+// String formats the URI, percent-encoding every component the same way Visual
+// Studio Code does. Notably, the colon of a drive letter is encoded, as in
+// `file:///c%3A/file.go`.
+func (uri ParsedURI) String() string {
+	var builder strings.Builder
+
+	builder.WriteString(uri.Scheme)
+	builder.WriteString(":")
+
+	if uri.Authority != "" || uri.Scheme == "file" {
+		builder.WriteString("//")
+		builder.WriteString(escapeURIComponent(strings.ToLower(uri.Authority), ":@"))
+
+		if uri.Path != "" && !strings.HasPrefix(uri.Path, "/") {
+			builder.WriteString("/")
+		}
+	}
+
+	builder.WriteString(escapeURIComponent(uri.Path, "/"))
+
+	if uri.Query != "" {
+		builder.WriteString("?")
+		builder.WriteString(escapeURIComponent(uri.Query, ""))
+	}
+
+	if uri.Fragment != "" {
+		builder.WriteString("#")
+		builder.WriteString(escapeURIComponent(uri.Fragment, ""))
+	}
+
+	return builder.String()
+}
+
+// normalize lower cases the scheme and, for `file` URIs, the drive letter, and
+// cleans the path, which also removes trailing slashes.
+func (uri ParsedURI) normalize() ParsedURI {
+	uri.Scheme = strings.ToLower(uri.Scheme)
+	uri.Authority = strings.ToLower(uri.Authority)
+
+	if uri.Scheme != "file" {
+		return uri
+	}
+
+	if uri.Path == "" {
+		uri.Path = "/"
+	}
+
+	uri.Path = path.Clean("/" + strings.TrimPrefix(uri.Path, "/"))
+
+	if drivePattern.MatchString(uri.Path) {
+		uri.Path = "/" + strings.ToLower(uri.Path[1:2]) + uri.Path[2:]
+		if len(uri.Path) == 3 {
+			// Keep the slash of a drive's root, like in `/c:/`.
+			uri.Path += "/"
+		}
+	}
+
+	return uri
+}
+
+// FromPath converts an absolute file system path into a `file` URI. Windows
+// paths can use drive letters or UNC shares. The result is normalized. It
+// fails if the path is relative, since a URI can't express it.
+func FromPath(filePath string, style PathStyle) (DocumentURI, error) {
+	if !isAbsolutePath(filePath, style) {
+		return "", fmt.Errorf("%q is not an absolute path", filePath)
+	}
+
+	uri := ParsedURI{Scheme: "file"}
+
+	if style == PSWindows {
+		filePath = strings.ReplaceAll(filePath, `\`, "/")
+
+		if strings.HasPrefix(filePath, "//") {
+			share := filePath[2:]
+			if index := strings.Index(share, "/"); index >= 0 {
+				uri.Authority, uri.Path = share[:index], share[index:]
+			} else {
+				uri.Authority, uri.Path = share, "/"
+			}
+
+			return DocumentURI(uri.normalize().String()), nil
+		}
+	}
+
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+
+	uri.Path = filePath
+	return DocumentURI(uri.normalize().String()), nil
+}
+
+// isAbsolutePath reports whether a path of the given style is absolute.
+// Windows paths are absolute if they start with a drive letter followed by a
+// separator, or with a UNC share.
+func isAbsolutePath(filePath string, style PathStyle) bool {
+	if style == PSWindows {
+		filePath = strings.ReplaceAll(filePath, `\`, "/")
+		return strings.HasPrefix(filePath, "//") || drivePattern.MatchString(filePath) && !strings.HasSuffix(filePath, ":")
+	}
+
+	return strings.HasPrefix(filePath, "/")
+}
+
+// ToPath converts a `file` URI into a file system path of the given style.
+// URIs with an authority become UNC paths on Windows and paths starting with
+// `//` on POSIX systems. The path isn't cleaned.
+func (uri DocumentURI) ToPath(style PathStyle) (string, error) {
+	parsed, err := ParseURI(string(uri))
+	if err != nil {
+		return "", err
+	}
+
+	if strings.ToLower(parsed.Scheme) != "file" {
+		return "", fmt.Errorf("%s is not a file URI", uri)
+	}
+
+	filePath := parsed.Path
+	if filePath == "" {
+		filePath = "/"
+	}
+
+	if parsed.Authority != "" && !strings.EqualFold(parsed.Authority, "localhost") {
+		filePath = "//" + parsed.Authority + filePath
+	} else if style == PSWindows && drivePattern.MatchString(filePath) {
+		filePath = strings.ToLower(filePath[1:2]) + filePath[2:]
+		if len(filePath) == 2 {
+			filePath += "/"
+		}
+	}
+
+	if style == PSWindows {
+		filePath = strings.ReplaceAll(filePath, "/", `\`)
+	}
+
+	return filePath, nil
+}
+
+// Normalize returns the canonical form of the URI: the scheme is lower cased,
+// the components are percent-encoded consistently and, for `file` URIs, the
+// drive letter is lower cased and the path is cleaned, including trailing
+// slashes. URIs that can't be parsed are returned unchanged.
+func (uri DocumentURI) Normalize() DocumentURI {
+	parsed, err := ParseURI(string(uri))
+	if err != nil {
+		return uri
+	}
+
+	return DocumentURI(parsed.normalize().String())
+}
+
+// Equal reports whether two URIs denote the same resource, ignoring
+// differences in percent-encoding, drive letter casing and trailing slashes.
+func (uri DocumentURI) Equal(other DocumentURI) bool {
+	return uri.Normalize() == other.Normalize()
+}
+
+// Join appends slash separated path elements to the path of the URI and cleans
+// the result, so elements can also be `..`. The query and the fragment are
+// dropped. URIs that can't be parsed are returned unchanged.
+func (uri DocumentURI) Join(elements ...string) DocumentURI {
+	parsed, err := ParseURI(string(uri))
+	if err != nil {
+		return uri
+	}
+
+	parsed.Path = path.Join(append([]string{parsed.Path}, elements...)...)
+	parsed.Query = ""
+	parsed.Fragment = ""
+
+	return DocumentURI(parsed.normalize().String())
+}
+
+// escapeURIComponent percent-encodes every byte of a URI component, except
+// for unreserved characters and the given allowed characters.
+func escapeURIComponent(component string, allowed string) string {
+	const hex = "0123456789ABCDEF"
+
+	var builder strings.Builder
+	for i := 0; i < len(component); i++ {
+		c := component[i]
+
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' || strings.IndexByte(allowed, c) >= 0 {
+			builder.WriteByte(c)
+			continue
+		}
+
+		builder.WriteByte('%')
+		builder.WriteByte(hex[c>>4])
+		builder.WriteByte(hex[c&0xF])
+	}
+
+	return builder.String()
+}
+
+// unescapeURIComponent decodes the percent-encoding of a URI component,
+// keeping invalid escape sequences as they are.
+func unescapeURIComponent(component string) string {
+	if !strings.Contains(component, "%") {
+		return component
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(component); i++ {
+		if component[i] == '%' && i+2 < len(component) {
+			high, highOK := unhex(component[i+1])
+			low, lowOK := unhex(component[i+2])
+
+			if highOK && lowOK {
+				builder.WriteByte(high<<4 | low)
+				i += 2
+				continue
+			}
+		}
+
+		builder.WriteByte(component[i])
+	}
+
+	return builder.String()
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+
+	return 0, false
+}
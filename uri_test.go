@@ -0,0 +1,142 @@
+package lsp
+
+import "testing"
+
+func TestFromPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		style PathStyle
+		uri   DocumentURI
+	}{
+		{"/home/user/file.go", PSPOSIX, "file:///home/user/file.go"},
+		{"/home/user/my file#1.go", PSPOSIX, "file:///home/user/my%20file%231.go"},
+		{"/home/user/dir/", PSPOSIX, "file:///home/user/dir"},
+		{`C:\Users\user\file.go`, PSWindows, "file:///c%3A/Users/user/file.go"},
+		{`C:\`, PSWindows, "file:///c%3A/"},
+		{`\\Server\share\file.go`, PSWindows, "file://server/share/file.go"},
+	}
+
+	for _, test := range tests {
+		uri, err := FromPath(test.path, test.style)
+		if err != nil {
+			t.Errorf("%s (%v): %v", test.path, test.style, err)
+		} else if uri != test.uri {
+			t.Errorf("%s (%v): expected %s, got %s", test.path, test.style, test.uri, uri)
+		}
+	}
+}
+
+func TestFromRelativePath(t *testing.T) {
+	tests := []struct {
+		path  string
+		style PathStyle
+	}{
+		{"", PSPOSIX},
+		{"main.go", PSPOSIX},
+		{"./src/main.go", PSPOSIX},
+		{"../main.go", PSPOSIX},
+		{`src\main.go`, PSWindows},
+		{`\src\main.go`, PSWindows},
+		{`C:main.go`, PSWindows},
+		{`C:`, PSWindows},
+	}
+
+	for _, test := range tests {
+		if uri, err := FromPath(test.path, test.style); err == nil {
+			t.Errorf("%q (%v): relative path has been converted to %s", test.path, test.style, uri)
+		}
+	}
+}
+
+func TestToPath(t *testing.T) {
+	tests := []struct {
+		uri   DocumentURI
+		style PathStyle
+		path  string
+	}{
+		{"file:///home/user/my%20file.go", PSPOSIX, "/home/user/my file.go"},
+		{"file:///C:/Users/file.go", PSWindows, `c:\Users\file.go`},
+		{"file:///c%3A", PSWindows, `c:\`},
+		{"file://server/share/file.go", PSWindows, `\\server\share\file.go`},
+		{"file://localhost/etc/hosts", PSPOSIX, "/etc/hosts"},
+	}
+
+	for _, test := range tests {
+		path, err := test.uri.ToPath(test.style)
+		if err != nil {
+			t.Errorf("%s: %v", test.uri, err)
+		} else if path != test.path {
+			t.Errorf("%s (%v): expected %s, got %s", test.uri, test.style, test.path, path)
+		}
+	}
+
+	for _, uri := range []DocumentURI{"untitled:Untitled-1", "/no/scheme"} {
+		if _, err := uri.ToPath(PSPOSIX); err == nil {
+			t.Errorf("%s has been converted to a path", uri)
+		}
+	}
+}
+
+func TestPathRoundTrip(t *testing.T) {
+	tests := []struct {
+		path  string
+		style PathStyle
+	}{
+		{"/home/user/100% done [draft].go", PSPOSIX},
+		{"/home/user/ünïcödé.go", PSPOSIX},
+		{`c:\Users\user\a b.go`, PSWindows},
+		{`\\server\share\file.go`, PSWindows},
+	}
+
+	for _, test := range tests {
+		uri, err := FromPath(test.path, test.style)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+
+		path, err := uri.ToPath(test.style)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+		} else if path != test.path {
+			t.Errorf("expected %s, got %s", test.path, path)
+		}
+	}
+}
+
+func TestURIEqual(t *testing.T) {
+	tests := []struct {
+		a, b  DocumentURI
+		equal bool
+	}{
+		{"file:///c:/file.go", "file:///C%3A/file.go", true},
+		{"file:///home/user/dir/", "file:///home/user/dir", true},
+		{"FILE:///a/%62.go", "file:///a/b.go", true},
+		{"file:///a/b.go", "file:///a/B.go", false},
+		{"untitled:Untitled-1", "untitled:Untitled-2", false},
+	}
+
+	for _, test := range tests {
+		if equal := test.a.Equal(test.b); equal != test.equal {
+			t.Errorf("%s == %s: expected %v, got %v", test.a, test.b, test.equal, equal)
+		}
+	}
+}
+
+func TestURIJoin(t *testing.T) {
+	tests := []struct {
+		uri      DocumentURI
+		elements []string
+		expected DocumentURI
+	}{
+		{"file:///home/user", []string{"src", "main.go"}, "file:///home/user/src/main.go"},
+		{"file:///home/user/src", []string{"..", "go.mod"}, "file:///home/user/go.mod"},
+		{"file:///home/user?query#fragment", []string{"a.go"}, "file:///home/user/a.go"},
+	}
+
+	for _, test := range tests {
+		if joined := test.uri.Join(test.elements...); joined != test.expected {
+			t.Errorf("%s + %v: expected %s, got %s", test.uri, test.elements, test.expected, joined)
+		}
+	}
+}
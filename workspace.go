@@ -1,5 +1,10 @@
 package lsp
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // WorkspaceFolder is a structure that defines the reference to a workspace
 // folder.
 type WorkspaceFolder struct {
@@ -173,6 +178,65 @@ func NewDeleteFile(URI DocumentURI, options DeleteFileOptions) *DeleteFile {
 // `TextDocumentEdit`, `CreateFile`, `RenameFile`, or `DeleteFile`.
 type WorkspaceEditDocumentChange interface{}
 
+// documentChangeOf turns a document change into a pointer to its concrete type,
+// which is one of `*TextDocumentEdit`, `*CreateFile`, `*RenameFile` or
+// `*DeleteFile`. Besides the concrete types (as values or pointers), it also
+// accepts the generic maps produced when a `WorkspaceEdit` is decoded from
+// JSON.
+func documentChangeOf(change WorkspaceEditDocumentChange) (interface{}, error) {
+	switch change := change.(type) {
+	case TextDocumentEdit:
+		return &change, nil
+	case *TextDocumentEdit:
+		return change, nil
+	case CreateFile:
+		return &change, nil
+	case *CreateFile:
+		return change, nil
+	case RenameFile:
+		return &change, nil
+	case *RenameFile:
+		return change, nil
+	case DeleteFile:
+		return &change, nil
+	case *DeleteFile:
+		return change, nil
+	}
+
+	data, err := json.Marshal(change)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Kind string `json:"kind"`
+	}
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("unsupported document change %T", change)
+	}
+
+	var result interface{}
+	switch header.Kind {
+	case "":
+		result = &TextDocumentEdit{}
+	case "create":
+		result = &CreateFile{}
+	case "rename":
+		result = &RenameFile{}
+	case "delete":
+		result = &DeleteFile{}
+	default:
+		return nil, fmt.Errorf("unsupported document change kind %q", header.Kind)
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // WorkspaceEdit represents changes to many resources managed in the workspace.
 type WorkspaceEdit struct {
 	// Holds changes to existing resources.
@@ -0,0 +1,254 @@
+package lsp
+
+import (
+	"fmt"
+)
+
+// WorkspaceEditAdaptOptions controls how `AdaptWorkspaceEdit` handles the
+// parts of an edit the client can't honor.
+type WorkspaceEditAdaptOptions struct {
+	// DropConfirmations allows dropping change annotations that need
+	// confirmation when the client doesn't support annotations. The changes
+	// are then applied without asking the user.
+	DropConfirmations bool
+
+	// Atomic requires the edit to be applied either entirely or not at all.
+	// The edit is rejected if the `failureHandling` of the client doesn't
+	// guarantee it, e.g. for a client that aborts halfway through.
+	Atomic bool
+}
+
+// AdaptWorkspaceEdit rewrites a workspace edit into a form the client can
+// handle, based on its `workspace.workspaceEdit` capabilities. A nil
+// capabilities object is treated as a client that only supports plain
+// `Changes`, and nil options as the zero options.
+//
+//   - If the client doesn't support `documentChanges`, the text document edits
+//     are converted into `Changes`. Edits made to the same document in more
+//     than one `TextDocumentEdit` can't be converted and cause an error.
+//   - Resource operations the client doesn't support cause an error, since
+//     they can't be expressed in any other way.
+//   - If the client doesn't support change annotations, all annotations are
+//     dropped. If a change refers to an annotation that needs confirmation,
+//     this causes an error, unless the options allow dropping confirmations.
+//   - If the options require the edit to be atomic, an edit with more than one
+//     change causes an error unless the client applies it transactionally.
+//     Clients with `FHKTextOnlyTransactional` qualify as long as the edit
+//     doesn't contain resource operations.
+//
+// The original edit is left untouched.
+func AdaptWorkspaceEdit(edit WorkspaceEdit, capabilities *WorkspaceEditClientCapabilities, options *WorkspaceEditAdaptOptions) (WorkspaceEdit, error) {
+	if options == nil {
+		options = &WorkspaceEditAdaptOptions{}
+	}
+
+	documentChanges := capabilities != nil && capabilities.DocumentChanges
+	annotations := capabilities != nil && capabilities.ChangeAnnotationSupport != nil
+
+	// confirm fails if the annotation of a change needs confirmation, but is
+	// about to be dropped.
+	confirm := func(id ChangeAnnotationIdentifier) error {
+		if annotations || options.DropConfirmations || id == "" {
+			return nil
+		}
+
+		if annotation := edit.ChangeAnnotations[id]; annotation != nil && annotation.NeedsConfirmation {
+			return fmt.Errorf("client doesn't support change annotations, but %q needs confirmation", id)
+		}
+
+		return nil
+	}
+
+	result := WorkspaceEdit{}
+	if annotations {
+		result.ChangeAnnotations = edit.ChangeAnnotations
+	}
+
+	// Clients prefer `documentChanges` over `changes` if both are present, so
+	// `changes` is only looked at when there are no document changes.
+	if len(edit.DocumentChanges) == 0 {
+		if options.Atomic && len(edit.Changes) > 1 && !appliesTransactionally(capabilities, false) {
+			return WorkspaceEdit{}, fmt.Errorf("client can't apply changes to %d documents atomically", len(edit.Changes))
+		}
+
+		if edit.Changes != nil {
+			result.Changes = map[DocumentURI][]TextEdit{}
+			for uri, edits := range edit.Changes {
+				for _, textEdit := range edits {
+					if err := confirm(textEdit.AnnotationID); err != nil {
+						return WorkspaceEdit{}, fmt.Errorf("%s: %v", uri, err)
+					}
+				}
+
+				result.Changes[uri] = adaptTextEdits(edits, annotations)
+			}
+		}
+
+		return result, nil
+	}
+
+	resourceOperations := false
+	changes := make([]interface{}, len(edit.DocumentChanges))
+	for i, documentChange := range edit.DocumentChanges {
+		change, err := documentChangeOf(documentChange)
+		if err != nil {
+			return WorkspaceEdit{}, fmt.Errorf("change %d: %v", i, err)
+		}
+
+		if kind, ok := resourceOperationKindOf(change); ok {
+			if !supportsResourceOperation(capabilities, kind) {
+				return WorkspaceEdit{}, fmt.Errorf("change %d: client doesn't support %s operations", i, kind)
+			}
+
+			resourceOperations = true
+		}
+
+		for _, id := range annotationIDsOf(change) {
+			if err := confirm(id); err != nil {
+				return WorkspaceEdit{}, fmt.Errorf("change %d: %v", i, err)
+			}
+		}
+
+		changes[i] = change
+	}
+
+	if options.Atomic && len(changes) > 1 && !appliesTransactionally(capabilities, resourceOperations) {
+		return WorkspaceEdit{}, fmt.Errorf("client can't apply %d changes atomically", len(changes))
+	}
+
+	if !documentChanges {
+		result.Changes = map[DocumentURI][]TextEdit{}
+		for _, change := range changes {
+			// Only text document edits are left at this point, every resource
+			// operation would have been rejected above.
+			document := change.(*TextDocumentEdit)
+
+			uri := document.TextDocument.URI
+			if _, ok := result.Changes[uri]; ok {
+				return WorkspaceEdit{}, fmt.Errorf("%s is edited more than once and can't be converted to changes", uri)
+			}
+
+			result.Changes[uri] = adaptTextEdits(document.Edits, annotations)
+		}
+
+		return result, nil
+	}
+
+	result.DocumentChanges = make([]WorkspaceEditDocumentChange, len(changes))
+	for i, change := range changes {
+		switch change := change.(type) {
+		case *TextDocumentEdit:
+			result.DocumentChanges[i] = TextDocumentEdit{
+				TextDocument: change.TextDocument,
+				Edits:        adaptTextEdits(change.Edits, annotations),
+			}
+		case *CreateFile:
+			operation := *change
+			if !annotations {
+				operation.AnnotationID = ""
+			}
+
+			result.DocumentChanges[i] = operation
+		case *RenameFile:
+			operation := *change
+			if !annotations {
+				operation.AnnotationID = ""
+			}
+
+			result.DocumentChanges[i] = operation
+		case *DeleteFile:
+			operation := *change
+			if !annotations {
+				operation.AnnotationID = ""
+			}
+
+			result.DocumentChanges[i] = operation
+		}
+	}
+
+	return result, nil
+}
+
+// adaptTextEdits copies a list of text edits, dropping their annotations if
+// the client doesn't support them.
+func adaptTextEdits(edits []TextEdit, annotations bool) []TextEdit {
+	result := make([]TextEdit, len(edits))
+	copy(result, edits)
+
+	if !annotations {
+		for i := range result {
+			result[i].AnnotationID = ""
+		}
+	}
+
+	return result
+}
+
+// annotationIDsOf returns the annotations a document change refers to.
+func annotationIDsOf(change interface{}) []ChangeAnnotationIdentifier {
+	switch change := change.(type) {
+	case *TextDocumentEdit:
+		ids := make([]ChangeAnnotationIdentifier, len(change.Edits))
+		for i, edit := range change.Edits {
+			ids[i] = edit.AnnotationID
+		}
+
+		return ids
+	case *CreateFile:
+		return []ChangeAnnotationIdentifier{change.AnnotationID}
+	case *RenameFile:
+		return []ChangeAnnotationIdentifier{change.AnnotationID}
+	case *DeleteFile:
+		return []ChangeAnnotationIdentifier{change.AnnotationID}
+	}
+
+	return nil
+}
+
+// appliesTransactionally reports whether the client applies a workspace edit
+// either entirely or not at all, based on its failure handling.
+func appliesTransactionally(capabilities *WorkspaceEditClientCapabilities, resourceOperations bool) bool {
+	if capabilities == nil {
+		return false
+	}
+
+	switch capabilities.FailureHandling {
+	case FHKTransactional:
+		return true
+	case FHKTextOnlyTransactional:
+		return !resourceOperations
+	}
+
+	return false
+}
+
+// resourceOperationKindOf returns the kind of a resource operation. The second
+// return value is false if the change is a text document edit.
+func resourceOperationKindOf(change interface{}) (ResourceOperationKind, bool) {
+	switch change.(type) {
+	case *CreateFile:
+		return ROKCreate, true
+	case *RenameFile:
+		return ROKRename, true
+	case *DeleteFile:
+		return ROKDelete, true
+	}
+
+	return "", false
+}
+
+// supportsResourceOperation reports whether the client supports the given kind
+// of resource operations.
+func supportsResourceOperation(capabilities *WorkspaceEditClientCapabilities, kind ResourceOperationKind) bool {
+	if capabilities == nil || !capabilities.DocumentChanges {
+		return false
+	}
+
+	for _, supported := range capabilities.ResourceOperations {
+		if supported == kind {
+			return true
+		}
+	}
+
+	return false
+}
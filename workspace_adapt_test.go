@@ -0,0 +1,92 @@
+package lsp
+
+import "testing"
+
+func confirmedWorkspaceEdit() WorkspaceEdit {
+	return WorkspaceEdit{
+		Changes: map[DocumentURI][]TextEdit{
+			"file:///a.go": {{NewText: "a", AnnotationID: "confirm"}},
+		},
+		ChangeAnnotations: map[ChangeAnnotationIdentifier]*ChangeAnnotation{
+			"confirm": {Label: "Rename", NeedsConfirmation: true},
+		},
+	}
+}
+
+func TestAdaptWorkspaceEditConfirmations(t *testing.T) {
+	if _, err := AdaptWorkspaceEdit(confirmedWorkspaceEdit(), nil, nil); err == nil {
+		t.Error("annotation needing confirmation has been dropped")
+	}
+
+	adapted, err := AdaptWorkspaceEdit(confirmedWorkspaceEdit(), nil, &WorkspaceEditAdaptOptions{DropConfirmations: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if adapted.ChangeAnnotations != nil || adapted.Changes["file:///a.go"][0].AnnotationID != "" {
+		t.Errorf("annotations haven't been dropped: %+v", adapted)
+	}
+
+	capabilities := &WorkspaceEditClientCapabilities{}
+	capabilities.ChangeAnnotationSupport = &struct {
+		GroupsOnLabel bool `json:"groupsOnLabel,omitempty"`
+	}{}
+
+	adapted, err = AdaptWorkspaceEdit(confirmedWorkspaceEdit(), capabilities, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if adapted.Changes["file:///a.go"][0].AnnotationID != "confirm" {
+		t.Errorf("annotations have been dropped: %+v", adapted)
+	}
+}
+
+func TestAdaptWorkspaceEditAtomic(t *testing.T) {
+	edit := WorkspaceEdit{
+		DocumentChanges: []WorkspaceEditDocumentChange{
+			TextDocumentEdit{
+				TextDocument: VersionedTextDocumentIdentifier{TextDocumentIdentifier: TextDocumentIdentifier{URI: "file:///a.go"}},
+				Edits:        []TextEdit{{NewText: "a"}},
+			},
+			CreateFile{Kind: "create", URI: "file:///b.go"},
+		},
+	}
+
+	tests := []struct {
+		failureHandling FailureHandlingKind
+		atomic          bool
+	}{
+		{"", false},
+		{FHKAbort, false},
+		{FHKUndo, false},
+		{FHKTextOnlyTransactional, false},
+		{FHKTransactional, true},
+	}
+
+	for _, test := range tests {
+		capabilities := &WorkspaceEditClientCapabilities{
+			DocumentChanges:    true,
+			ResourceOperations: []ResourceOperationKind{ROKCreate},
+			FailureHandling:    test.failureHandling,
+		}
+
+		if _, err := AdaptWorkspaceEdit(edit, capabilities, nil); err != nil {
+			t.Errorf("%q: %v", test.failureHandling, err)
+		}
+
+		_, err := AdaptWorkspaceEdit(edit, capabilities, &WorkspaceEditAdaptOptions{Atomic: true})
+		if (err == nil) != test.atomic {
+			t.Errorf("%q: expected atomic to be %v, got error %v", test.failureHandling, test.atomic, err)
+		}
+	}
+
+	textOnly := WorkspaceEdit{
+		DocumentChanges: []WorkspaceEditDocumentChange{edit.DocumentChanges[0], edit.DocumentChanges[0]},
+	}
+
+	capabilities := &WorkspaceEditClientCapabilities{DocumentChanges: true, FailureHandling: FHKTextOnlyTransactional}
+	if _, err := AdaptWorkspaceEdit(textOnly, capabilities, &WorkspaceEditAdaptOptions{Atomic: true}); err != nil {
+		t.Errorf("text only edit has been rejected: %v", err)
+	}
+}
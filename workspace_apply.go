@@ -0,0 +1,467 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// WorkspaceEditApplier applies workspace edits to files on the local file
+// system. It is the client-side counterpart of a `workspace/applyEdit` request
+// and can be used in tools that need to execute the edits computed by a
+// language server without an editor, e.g. in a command line rename tool.
+type WorkspaceEditApplier struct {
+	// Root restricts all operations to files and folders inside the given
+	// directory. An edit touching anything outside of it fails. If empty, no
+	// restriction is applied.
+	Root string
+
+	// The failure handling strategy used when one of the changes can't be
+	// applied. If omitted, it defaults to `FHKAbort`.
+	//
+	// On a local file system `FHKTransactional` and `FHKUndo` behave the same
+	// way: every change is journaled and the journal is rolled back as soon as
+	// a change fails. The only difference is in how a failed rollback is
+	// reported.
+	FailureHandling FailureHandlingKind
+}
+
+// Apply applies the given workspace edit. Document changes are executed in the
+// order they are provided in. If the edit only holds `Changes`, the documents
+// are processed in lexical order of their URIs.
+func (applier *WorkspaceEditApplier) Apply(edit WorkspaceEdit) ApplyWorkspaceEditResponse {
+	changes, err := applier.collect(edit)
+	if err != nil {
+		return ApplyWorkspaceEditResponse{FailureReason: err.Error()}
+	}
+
+	strategy := applier.FailureHandling
+	if strategy == "" {
+		strategy = FHKAbort
+	}
+
+	if strategy == FHKTextOnlyTransactional {
+		strategy = FHKTransactional
+		for _, change := range changes {
+			if _, ok := change.(*TextDocumentEdit); !ok {
+				strategy = FHKAbort
+				break
+			}
+		}
+	}
+
+	journal := &editJournal{enabled: strategy != FHKAbort}
+
+	for i, change := range changes {
+		if err := applier.applyChange(journal, change); err != nil {
+			reason := fmt.Sprintf("change %d failed: %v", i, err)
+
+			if journal.enabled {
+				if rollbackErr := journal.rollback(); rollbackErr != nil {
+					if strategy == FHKUndo {
+						reason += fmt.Sprintf("; undo incomplete: %v", rollbackErr)
+					} else {
+						reason += fmt.Sprintf("; rollback failed, the workspace may be inconsistent: %v", rollbackErr)
+					}
+				}
+			}
+
+			return ApplyWorkspaceEditResponse{FailureReason: reason}
+		}
+	}
+
+	journal.commit()
+	return ApplyWorkspaceEditResponse{Applied: true}
+}
+
+// collect returns the changes of a workspace edit in the order they have to be
+// applied in.
+func (applier *WorkspaceEditApplier) collect(edit WorkspaceEdit) ([]interface{}, error) {
+	changes := []interface{}{}
+
+	if len(edit.DocumentChanges) > 0 {
+		for i, documentChange := range edit.DocumentChanges {
+			change, err := documentChangeOf(documentChange)
+			if err != nil {
+				return nil, fmt.Errorf("change %d: %v", i, err)
+			}
+
+			changes = append(changes, change)
+		}
+
+		return changes, nil
+	}
+
+	uris := make([]string, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, string(uri))
+	}
+
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		changes = append(changes, &TextDocumentEdit{
+			TextDocument: VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: TextDocumentIdentifier{URI: DocumentURI(uri)},
+			},
+			Edits: edit.Changes[DocumentURI(uri)],
+		})
+	}
+
+	return changes, nil
+}
+
+func (applier *WorkspaceEditApplier) applyChange(journal *editJournal, change interface{}) error {
+	switch change := change.(type) {
+	case *TextDocumentEdit:
+		return applier.applyTextDocumentEdit(journal, change)
+	case *CreateFile:
+		return applier.createFile(journal, change)
+	case *RenameFile:
+		return applier.renameFile(journal, change)
+	case *DeleteFile:
+		return applier.deleteFile(journal, change)
+	}
+
+	return fmt.Errorf("unsupported document change %T", change)
+}
+
+func (applier *WorkspaceEditApplier) applyTextDocumentEdit(journal *editJournal, edit *TextDocumentEdit) error {
+	path, err := applier.path(edit.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	text, err := ApplyTextEdits(string(original), edit.Edits)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(text), info.Mode()); err != nil {
+		return err
+	}
+
+	journal.record(func() error {
+		return ioutil.WriteFile(path, original, info.Mode())
+	})
+
+	return nil
+}
+
+func (applier *WorkspaceEditApplier) createFile(journal *editJournal, create *CreateFile) error {
+	path, err := applier.path(create.URI)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if !create.Options.Overwrite {
+			if create.Options.IgnoreIfExists {
+				return nil
+			}
+
+			return fmt.Errorf("%s already exists", path)
+		}
+
+		if info.IsDir() {
+			return fmt.Errorf("%s is a folder and can't be replaced by a file", path)
+		}
+
+		if err := journal.remove(path, false); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := journal.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0o666); err != nil {
+		return err
+	}
+
+	journal.record(func() error {
+		return os.Remove(path)
+	})
+
+	return nil
+}
+
+func (applier *WorkspaceEditApplier) renameFile(journal *editJournal, rename *RenameFile) error {
+	oldPath, err := applier.path(rename.OldURI)
+	if err != nil {
+		return err
+	}
+
+	newPath, err := applier.path(rename.NewURI)
+	if err != nil {
+		return err
+	}
+
+	oldInfo, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if newInfo, err := os.Lstat(newPath); err == nil {
+		if !rename.Options.Overwrite {
+			if rename.Options.IgnoreIfExists {
+				return nil
+			}
+
+			return fmt.Errorf("%s already exists", newPath)
+		}
+
+		if newInfo.IsDir() && !oldInfo.IsDir() {
+			return fmt.Errorf("%s is a folder and can't be replaced by a file", newPath)
+		}
+
+		if err := journal.remove(newPath, true); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := journal.mkdirAll(filepath.Dir(newPath)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+
+	journal.record(func() error {
+		return os.Rename(newPath, oldPath)
+	})
+
+	return nil
+}
+
+func (applier *WorkspaceEditApplier) deleteFile(journal *editJournal, deletion *DeleteFile) error {
+	path, err := applier.path(deletion.URI)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(path); err != nil {
+		if os.IsNotExist(err) && deletion.Options.IgnoreIfNotExists {
+			return nil
+		}
+
+		return err
+	}
+
+	return journal.remove(path, deletion.Options.Recursive)
+}
+
+// path converts a document URI into a local file system path and makes sure
+// that it is located inside the root directory. Symbolic links are resolved
+// before checking, so that a link inside the root can't be used to reach files
+// outside of it.
+func (applier *WorkspaceEditApplier) path(uri DocumentURI) (string, error) {
+	path, err := uri.ToPath(NativePathStyle)
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.Clean(path)
+
+	if applier.Root == "" {
+		return path, nil
+	}
+
+	root, err := filepath.Abs(applier.Root)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedRoot, err := resolvePath(root)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of %s", path, root)
+	}
+
+	return path, nil
+}
+
+// resolvePath resolves the symbolic links of a path whose last elements don't
+// need to exist yet, like the path of a file that is about to be created. It
+// fails on dangling links, since writing to them would create their target.
+func resolvePath(path string) (string, error) {
+	missing := []string{}
+	for current := path; ; {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if _, err := os.Lstat(current); err == nil {
+			return "", fmt.Errorf("%s is a dangling symbolic link", current)
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, nil
+		}
+
+		missing = append([]string{filepath.Base(current)}, missing...)
+		current = parent
+	}
+}
+
+// editJournal keeps track of the operations executed while applying a
+// workspace edit so that they can be rolled back.
+type editJournal struct {
+	enabled bool
+	undo    []func() error
+	backups []string
+}
+
+// record adds an undo operation to the journal.
+func (journal *editJournal) record(undo func() error) {
+	if journal.enabled {
+		journal.undo = append(journal.undo, undo)
+	}
+}
+
+// remove deletes a file or folder. If the journal is enabled, the file is moved
+// into a backup folder instead, so it can be restored later.
+func (journal *editJournal) remove(path string, recursive bool) error {
+	if !journal.enabled {
+		if recursive {
+			return os.RemoveAll(path)
+		}
+
+		return os.Remove(path)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() && !recursive {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > 0 {
+			return fmt.Errorf("%s is not empty", path)
+		}
+	}
+
+	// The backup folder is created next to the file so that moving the file
+	// never has to cross file system boundaries.
+	backup, err := ioutil.TempDir(filepath.Dir(path), ".lsp-backup-")
+	if err != nil {
+		return err
+	}
+
+	journal.backups = append(journal.backups, backup)
+
+	target := filepath.Join(backup, filepath.Base(path))
+	if err := os.Rename(path, target); err != nil {
+		return err
+	}
+
+	journal.record(func() error {
+		return os.Rename(target, path)
+	})
+
+	return nil
+}
+
+// mkdirAll creates a folder along with its missing parents.
+func (journal *editJournal) mkdirAll(path string) error {
+	missing := []string{}
+	for current := path; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(current); err == nil {
+			break
+		}
+
+		missing = append(missing, current)
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(path, 0o777); err != nil {
+		return err
+	}
+
+	// Parents are recorded first, so they are removed last.
+	for i := len(missing) - 1; i >= 0; i-- {
+		folder := missing[i]
+		journal.record(func() error {
+			return os.Remove(folder)
+		})
+	}
+
+	return nil
+}
+
+// rollback undoes all recorded operations in reverse order.
+func (journal *editJournal) rollback() error {
+	var errs []string
+	for i := len(journal.undo) - 1; i >= 0; i-- {
+		if err := journal.undo[i](); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	journal.undo = nil
+
+	if len(errs) > 0 {
+		// Backups that couldn't be restored must not be thrown away.
+		errs = append(errs, "backups were kept in "+strings.Join(journal.backups, ", "))
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	journal.removeBackups()
+	return nil
+}
+
+// commit discards the journal, making all operations permanent.
+func (journal *editJournal) commit() {
+	journal.undo = nil
+	journal.removeBackups()
+}
+
+func (journal *editJournal) removeBackups() {
+	for i := len(journal.backups) - 1; i >= 0; i-- {
+		os.RemoveAll(journal.backups[i])
+	}
+
+	journal.backups = nil
+}
@@ -0,0 +1,331 @@
+package lsp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates the given files, relative to root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles returns the contents of all files below root, keyed by their slash
+// separated path relative to root. Folders are listed with a trailing slash.
+func readFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		relative = filepath.ToSlash(relative)
+		if info.IsDir() {
+			files[relative+"/"] = ""
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(path)
+		files[relative] = string(content)
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+// checkFiles fails the test if the files below root differ from the expected
+// ones.
+func checkFiles(t *testing.T, name string, root string, expected map[string]string) {
+	t.Helper()
+
+	files := readFiles(t, root)
+	if len(files) != len(expected) {
+		t.Errorf("%s: expected files %q, got %q", name, expected, files)
+		return
+	}
+
+	for path, content := range expected {
+		if actual, ok := files[path]; !ok || actual != content {
+			t.Errorf("%s: expected files %q, got %q", name, expected, files)
+			return
+		}
+	}
+}
+
+func fileURIOf(root, name string) DocumentURI {
+	uri, err := FromPath(filepath.Join(root, name), NativePathStyle)
+	if err != nil {
+		panic(err)
+	}
+
+	return uri
+}
+
+func insertAt(line, character int, text string) TextEdit {
+	position := Position{Line: line, Character: character}
+	return TextEdit{Range: Range{Start: position, End: position}, NewText: text}
+}
+
+func TestWorkspaceEditApplierChanges(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+
+	applier := &WorkspaceEditApplier{Root: root}
+	response := applier.Apply(WorkspaceEdit{
+		Changes: map[DocumentURI][]TextEdit{
+			fileURIOf(root, "a.txt"): {insertAt(0, 1, "1")},
+			fileURIOf(root, "b.txt"): {insertAt(1, 0, "2\n")},
+		},
+	})
+
+	if !response.Applied {
+		t.Fatal(response.FailureReason)
+	}
+
+	checkFiles(t, "changes", root, map[string]string{"a.txt": "a1\n", "b.txt": "b\n2\n"})
+}
+
+func TestWorkspaceEditApplierFailureHandling(t *testing.T) {
+	tests := []struct {
+		failureHandling FailureHandlingKind
+		textOnly        bool
+		rolledBack      bool
+	}{
+		{"", false, false},
+		{FHKAbort, false, false},
+		{FHKTransactional, false, true},
+		{FHKUndo, false, true},
+		{FHKTextOnlyTransactional, false, false},
+		{FHKTextOnlyTransactional, true, true},
+		{FHKAbort, true, false},
+	}
+
+	for _, test := range tests {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"a.txt": "a\n", "old/c.txt": "c\n"})
+
+		edit := WorkspaceEdit{
+			DocumentChanges: []WorkspaceEditDocumentChange{
+				TextDocumentEdit{
+					TextDocument: VersionedTextDocumentIdentifier{TextDocumentIdentifier: TextDocumentIdentifier{URI: fileURIOf(root, "a.txt")}},
+					Edits:        []TextEdit{insertAt(0, 0, "1")},
+				},
+			},
+		}
+
+		if !test.textOnly {
+			edit.DocumentChanges = append(edit.DocumentChanges,
+				CreateFile{Kind: "create", URI: fileURIOf(root, "new/b.txt")},
+				RenameFile{Kind: "rename", OldURI: fileURIOf(root, "old/c.txt"), NewURI: fileURIOf(root, "c.txt")},
+				DeleteFile{Kind: "delete", URI: fileURIOf(root, "old"), Options: DeleteFileOptions{Recursive: true}},
+			)
+		}
+
+		// The last change fails, since the file doesn't exist.
+		edit.DocumentChanges = append(edit.DocumentChanges, TextDocumentEdit{
+			TextDocument: VersionedTextDocumentIdentifier{TextDocumentIdentifier: TextDocumentIdentifier{URI: fileURIOf(root, "missing.txt")}},
+			Edits:        []TextEdit{insertAt(0, 0, "1")},
+		})
+
+		applier := &WorkspaceEditApplier{Root: root, FailureHandling: test.failureHandling}
+		if response := applier.Apply(edit); response.Applied || response.FailureReason == "" {
+			t.Errorf("%q: expected the edit to fail, got %+v", test.failureHandling, response)
+			continue
+		}
+
+		name := string(test.failureHandling)
+		switch {
+		case test.rolledBack:
+			checkFiles(t, name, root, map[string]string{"a.txt": "a\n", "old/": "", "old/c.txt": "c\n"})
+		case test.textOnly:
+			checkFiles(t, name, root, map[string]string{"a.txt": "1a\n", "old/": "", "old/c.txt": "c\n"})
+		default:
+			checkFiles(t, name, root, map[string]string{"a.txt": "1a\n", "new/": "", "new/b.txt": "", "c.txt": "c\n"})
+		}
+	}
+}
+
+func TestWorkspaceEditApplierResourceOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  WorkspaceEditDocumentChange
+		applied bool
+		files   map[string]string
+	}{
+		{
+			"create existing",
+			CreateFile{Kind: "create", URI: "a.txt"},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"create existing ignored",
+			CreateFile{Kind: "create", URI: "a.txt", Options: CreateFileOptions{IgnoreIfExists: true}},
+			true,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"create overwrite",
+			CreateFile{Kind: "create", URI: "a.txt", Options: CreateFileOptions{Overwrite: true}},
+			true,
+			map[string]string{"a.txt": "", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"create overwrite folder",
+			CreateFile{Kind: "create", URI: "dir", Options: CreateFileOptions{Overwrite: true}},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"rename existing",
+			RenameFile{Kind: "rename", OldURI: "dir/d.txt", NewURI: "a.txt"},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"rename existing ignored",
+			RenameFile{Kind: "rename", OldURI: "dir/d.txt", NewURI: "a.txt", Options: RenameFileOptions{IgnoreIfExists: true}},
+			true,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"rename overwrite",
+			RenameFile{Kind: "rename", OldURI: "dir/d.txt", NewURI: "a.txt", Options: RenameFileOptions{Overwrite: true}},
+			true,
+			map[string]string{"a.txt": "d", "dir/": ""},
+		},
+		{
+			"rename overwrite folder",
+			RenameFile{Kind: "rename", OldURI: "a.txt", NewURI: "dir", Options: RenameFileOptions{Overwrite: true}},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"delete non-empty folder",
+			DeleteFile{Kind: "delete", URI: "dir"},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"delete recursive",
+			DeleteFile{Kind: "delete", URI: "dir", Options: DeleteFileOptions{Recursive: true}},
+			true,
+			map[string]string{"a.txt": "a"},
+		},
+		{
+			"delete missing",
+			DeleteFile{Kind: "delete", URI: "missing.txt"},
+			false,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+		{
+			"delete missing ignored",
+			DeleteFile{Kind: "delete", URI: "missing.txt", Options: DeleteFileOptions{IgnoreIfNotExists: true}},
+			true,
+			map[string]string{"a.txt": "a", "dir/": "", "dir/d.txt": "d"},
+		},
+	}
+
+	for _, test := range tests {
+		for _, failureHandling := range []FailureHandlingKind{FHKAbort, FHKTransactional} {
+			root := t.TempDir()
+			writeFiles(t, root, map[string]string{"a.txt": "a", "dir/d.txt": "d"})
+
+			// URIs are given relative to the root in the table.
+			change := test.change
+			switch operation := change.(type) {
+			case CreateFile:
+				operation.URI = fileURIOf(root, string(operation.URI))
+				change = operation
+			case RenameFile:
+				operation.OldURI = fileURIOf(root, string(operation.OldURI))
+				operation.NewURI = fileURIOf(root, string(operation.NewURI))
+				change = operation
+			case DeleteFile:
+				operation.URI = fileURIOf(root, string(operation.URI))
+				change = operation
+			}
+
+			applier := &WorkspaceEditApplier{Root: root, FailureHandling: failureHandling}
+			response := applier.Apply(WorkspaceEdit{DocumentChanges: []WorkspaceEditDocumentChange{change}})
+			if response.Applied != test.applied {
+				t.Errorf("%s (%s): expected applied to be %v, got %+v", test.name, failureHandling, test.applied, response)
+			}
+
+			// Backups are removed, whatever the outcome.
+			checkFiles(t, test.name+" ("+string(failureHandling)+")", root, test.files)
+		}
+	}
+}
+
+func TestWorkspaceEditApplierRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	outside := filepath.Join(parent, "outside")
+	writeFiles(t, parent, map[string]string{"root/a.txt": "a", "outside/b.txt": "b"})
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symbolic links aren't supported: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	uris := []DocumentURI{
+		fileURIOf(outside, "b.txt"),
+		fileURIOf(root, "../outside/b.txt"),
+		fileURIOf(root, "link/b.txt"),
+		fileURIOf(root, "link/new.txt"),
+		fileURIOf(root, "dangling"),
+	}
+
+	applier := &WorkspaceEditApplier{Root: root}
+	for _, uri := range uris {
+		response := applier.Apply(WorkspaceEdit{
+			DocumentChanges: []WorkspaceEditDocumentChange{
+				CreateFile{Kind: "create", URI: uri, Options: CreateFileOptions{Overwrite: true}},
+			},
+		})
+
+		if response.Applied {
+			t.Errorf("%s: edit outside of the root has been applied", uri)
+		}
+	}
+
+	checkFiles(t, "outside", outside, map[string]string{"b.txt": "b"})
+
+	response := applier.Apply(WorkspaceEdit{
+		DocumentChanges: []WorkspaceEditDocumentChange{
+			CreateFile{Kind: "create", URI: fileURIOf(root, "sub/c.txt")},
+		},
+	})
+
+	if !response.Applied {
+		t.Errorf("edit inside of the root has been rejected: %s", response.FailureReason)
+	}
+}
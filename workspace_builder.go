@@ -0,0 +1,391 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WorkspaceEditBuilder helps with assembling a `WorkspaceEdit`.
+//
+// Text edits are always added to the document selected by the last call to
+// `Edit`. All edits made to a document between two resource operations are
+// expressed relative to the same state of the document; the builder sorts them,
+// merges adjacent ones and reports overlapping ones as an error.
+//
+// Every change added after a call to `Annotate` is annotated with the given
+// change annotation.
+//
+// Errors are collected along the way and reported when the edit is built, so
+// calls can be chained:
+//
+//	edit, err := NewWorkspaceEditBuilder().
+//		Annotate("Rename symbol", false).
+//		Edit(uri, version).
+//		Replace(rng, "newName").
+//		DocumentChanges()
+type WorkspaceEditBuilder struct {
+	changes     []interface{}
+	annotations map[ChangeAnnotationIdentifier]*ChangeAnnotation
+
+	// The document selected by `Edit`.
+	document *TextDocumentEdit
+
+	// The documents edited since the last resource operation.
+	documents map[DocumentURI]*TextDocumentEdit
+
+	// The annotation applied to new changes.
+	annotation ChangeAnnotationIdentifier
+
+	err error
+}
+
+// NewWorkspaceEditBuilder instantiates a WorkspaceEditBuilder.
+func NewWorkspaceEditBuilder() *WorkspaceEditBuilder {
+	return &WorkspaceEditBuilder{
+		annotations: map[ChangeAnnotationIdentifier]*ChangeAnnotation{},
+		documents:   map[DocumentURI]*TextDocumentEdit{},
+	}
+}
+
+// Annotate annotates all changes added from now on with a change annotation
+// with the given label. Calling it with an empty label stops annotating
+// changes.
+func (builder *WorkspaceEditBuilder) Annotate(label string, needsConfirmation bool) *WorkspaceEditBuilder {
+	if label == "" {
+		builder.annotation = ""
+		return builder
+	}
+
+	id := ChangeAnnotationIdentifier(label)
+	for suffix := 2; ; suffix++ {
+		existing, ok := builder.annotations[id]
+		if !ok {
+			builder.annotations[id] = &ChangeAnnotation{
+				Label:             label,
+				NeedsConfirmation: needsConfirmation,
+			}
+
+			break
+		}
+
+		if existing.Label == label && existing.NeedsConfirmation == needsConfirmation {
+			break
+		}
+
+		id = ChangeAnnotationIdentifier(fmt.Sprintf("%s#%d", label, suffix))
+	}
+
+	builder.annotation = id
+	return builder
+}
+
+// DefineAnnotation adds a change annotation with an explicit identifier. It
+// doesn't change the annotation applied to new changes; use `UseAnnotation`
+// for that.
+func (builder *WorkspaceEditBuilder) DefineAnnotation(id ChangeAnnotationIdentifier, annotation ChangeAnnotation) *WorkspaceEditBuilder {
+	builder.annotations[id] = &annotation
+	return builder
+}
+
+// UseAnnotation annotates all changes added from now on with the change
+// annotation of the given identifier. The annotation has to be defined through
+// `DefineAnnotation` by the time the edit is built.
+func (builder *WorkspaceEditBuilder) UseAnnotation(id ChangeAnnotationIdentifier) *WorkspaceEditBuilder {
+	builder.annotation = id
+	return builder
+}
+
+// Edit selects the document text edits are added to. Use version 0 if the
+// document's version is not known.
+func (builder *WorkspaceEditBuilder) Edit(uri DocumentURI, version int) *WorkspaceEditBuilder {
+	if document, ok := builder.documents[uri]; ok {
+		if document.TextDocument.Version != version {
+			builder.fail(fmt.Errorf("%s is edited with versions %d and %d", uri, document.TextDocument.Version, version))
+		}
+
+		builder.document = document
+		return builder
+	}
+
+	document := &TextDocumentEdit{
+		TextDocument: VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+			Version:                version,
+		},
+	}
+
+	builder.changes = append(builder.changes, document)
+	builder.documents[uri] = document
+	builder.document = document
+
+	return builder
+}
+
+// Insert inserts text at the given position of the selected document.
+func (builder *WorkspaceEditBuilder) Insert(position Position, text string) *WorkspaceEditBuilder {
+	return builder.Replace(Range{Start: position, End: position}, text)
+}
+
+// Replace replaces the given range of the selected document with text.
+func (builder *WorkspaceEditBuilder) Replace(rng Range, text string) *WorkspaceEditBuilder {
+	if builder.document == nil {
+		builder.fail(errors.New("text edit added before a document was selected"))
+		return builder
+	}
+
+	builder.document.Edits = append(builder.document.Edits, TextEdit{
+		Range:        rng,
+		NewText:      text,
+		AnnotationID: builder.annotation,
+	})
+
+	return builder
+}
+
+// Delete deletes the given range of the selected document.
+func (builder *WorkspaceEditBuilder) Delete(rng Range) *WorkspaceEditBuilder {
+	return builder.Replace(rng, "")
+}
+
+// CreateFile adds a file creation operation.
+func (builder *WorkspaceEditBuilder) CreateFile(uri DocumentURI, options CreateFileOptions) *WorkspaceEditBuilder {
+	operation := NewCreateFile(uri, options)
+	operation.AnnotationID = builder.annotation
+
+	return builder.addResourceOperation(operation)
+}
+
+// RenameFile adds a file rename operation.
+func (builder *WorkspaceEditBuilder) RenameFile(oldURI, newURI DocumentURI, options RenameFileOptions) *WorkspaceEditBuilder {
+	operation := NewRenameFile(oldURI, newURI, options)
+	operation.AnnotationID = builder.annotation
+
+	return builder.addResourceOperation(operation)
+}
+
+// DeleteFile adds a file deletion operation.
+func (builder *WorkspaceEditBuilder) DeleteFile(uri DocumentURI, options DeleteFileOptions) *WorkspaceEditBuilder {
+	operation := NewDeleteFile(uri, options)
+	operation.AnnotationID = builder.annotation
+
+	return builder.addResourceOperation(operation)
+}
+
+// addResourceOperation adds a resource operation. Text edits added afterwards
+// address the documents as they are after the operation, so they can't be
+// merged with the ones added before.
+func (builder *WorkspaceEditBuilder) addResourceOperation(operation interface{}) *WorkspaceEditBuilder {
+	builder.changes = append(builder.changes, operation)
+	builder.documents = map[DocumentURI]*TextDocumentEdit{}
+	builder.document = nil
+
+	return builder
+}
+
+// DocumentChanges builds the workspace edit using the `DocumentChanges`
+// property.
+func (builder *WorkspaceEditBuilder) DocumentChanges() (WorkspaceEdit, error) {
+	if err := builder.validate(); err != nil {
+		return WorkspaceEdit{}, err
+	}
+
+	edit := WorkspaceEdit{
+		DocumentChanges:   []WorkspaceEditDocumentChange{},
+		ChangeAnnotations: builder.usedAnnotations(),
+	}
+
+	for _, change := range builder.changes {
+		if document, ok := change.(*TextDocumentEdit); ok {
+			edits, err := normalizeTextEdits(document.TextDocument.URI, document.Edits)
+			if err != nil {
+				return WorkspaceEdit{}, err
+			}
+
+			if len(edits) == 0 {
+				continue
+			}
+
+			edit.DocumentChanges = append(edit.DocumentChanges, TextDocumentEdit{
+				TextDocument: document.TextDocument,
+				Edits:        edits,
+			})
+
+			continue
+		}
+
+		edit.DocumentChanges = append(edit.DocumentChanges, change)
+	}
+
+	return edit, nil
+}
+
+// Changes builds the workspace edit using the `Changes` property. This form
+// can't hold resource operations, nor document versions.
+func (builder *WorkspaceEditBuilder) Changes() (WorkspaceEdit, error) {
+	if err := builder.validate(); err != nil {
+		return WorkspaceEdit{}, err
+	}
+
+	edit := WorkspaceEdit{
+		Changes:           map[DocumentURI][]TextEdit{},
+		ChangeAnnotations: builder.usedAnnotations(),
+	}
+
+	for _, change := range builder.changes {
+		document, ok := change.(*TextDocumentEdit)
+		if !ok {
+			return WorkspaceEdit{}, errors.New("resource operations can't be expressed as changes")
+		}
+
+		edits, err := normalizeTextEdits(document.TextDocument.URI, document.Edits)
+		if err != nil {
+			return WorkspaceEdit{}, err
+		}
+
+		if len(edits) > 0 {
+			edit.Changes[document.TextDocument.URI] = edits
+		}
+	}
+
+	return edit, nil
+}
+
+func (builder *WorkspaceEditBuilder) fail(err error) {
+	if builder.err == nil {
+		builder.err = err
+	}
+}
+
+// validate reports the first error recorded while building and makes sure that
+// every referenced change annotation is defined.
+func (builder *WorkspaceEditBuilder) validate() error {
+	if builder.err != nil {
+		return builder.err
+	}
+
+	check := func(id ChangeAnnotationIdentifier) error {
+		if id == "" {
+			return nil
+		}
+
+		if _, ok := builder.annotations[id]; !ok {
+			return fmt.Errorf("change annotation %q is not defined", id)
+		}
+
+		return nil
+	}
+
+	for _, change := range builder.changes {
+		var err error
+
+		switch change := change.(type) {
+		case *TextDocumentEdit:
+			for _, edit := range change.Edits {
+				if err = check(edit.AnnotationID); err != nil {
+					break
+				}
+			}
+		case *CreateFile:
+			err = check(change.AnnotationID)
+		case *RenameFile:
+			err = check(change.AnnotationID)
+		case *DeleteFile:
+			err = check(change.AnnotationID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// usedAnnotations returns the change annotations referenced by at least one
+// change, or nil if there are none.
+func (builder *WorkspaceEditBuilder) usedAnnotations() map[ChangeAnnotationIdentifier]*ChangeAnnotation {
+	used := map[ChangeAnnotationIdentifier]*ChangeAnnotation{}
+	use := func(id ChangeAnnotationIdentifier) {
+		if id != "" {
+			used[id] = builder.annotations[id]
+		}
+	}
+
+	for _, change := range builder.changes {
+		switch change := change.(type) {
+		case *TextDocumentEdit:
+			for _, edit := range change.Edits {
+				use(edit.AnnotationID)
+			}
+		case *CreateFile:
+			use(change.AnnotationID)
+		case *RenameFile:
+			use(change.AnnotationID)
+		case *DeleteFile:
+			use(change.AnnotationID)
+		}
+	}
+
+	if len(used) == 0 {
+		return nil
+	}
+
+	return used
+}
+
+// normalizeTextEdits sorts a document's text edits by position and merges the
+// adjacent ones that share the same annotation. Inserts at the same position
+// keep the order they were added in, and come before an edit replacing the
+// range starting there, regardless of the order they were added in.
+func normalizeTextEdits(uri DocumentURI, edits []TextEdit) ([]TextEdit, error) {
+	sorted := make([]TextEdit, len(edits))
+	copy(sorted, edits)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if order := comparePositions(sorted[i].Range.Start, sorted[j].Range.Start); order != 0 {
+			return order < 0
+		}
+
+		return sorted[i].Range.Start == sorted[i].Range.End && sorted[j].Range.Start != sorted[j].Range.End
+	})
+
+	result := []TextEdit{}
+	for _, edit := range sorted {
+		if comparePositions(edit.Range.End, edit.Range.Start) < 0 {
+			return nil, fmt.Errorf("%s: text edit at %d:%d has an invalid range", uri, edit.Range.Start.Line, edit.Range.Start.Character)
+		}
+
+		if len(result) == 0 {
+			result = append(result, edit)
+			continue
+		}
+
+		last := &result[len(result)-1]
+		if comparePositions(edit.Range.Start, last.Range.End) < 0 {
+			return nil, fmt.Errorf("%s: text edits at %d:%d and %d:%d overlap", uri,
+				last.Range.Start.Line, last.Range.Start.Character,
+				edit.Range.Start.Line, edit.Range.Start.Character)
+		}
+
+		if edit.Range.Start == last.Range.End && edit.AnnotationID == last.AnnotationID {
+			last.Range.End = edit.Range.End
+			last.NewText += edit.NewText
+			continue
+		}
+
+		result = append(result, edit)
+	}
+
+	return result, nil
+}
+
+// comparePositions returns a negative number if a is located before b, a
+// positive number if a is located after b and zero if they are equal.
+func comparePositions(a, b Position) int {
+	if a.Line != b.Line {
+		return a.Line - b.Line
+	}
+
+	return a.Character - b.Character
+}
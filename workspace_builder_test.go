@@ -0,0 +1,213 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWorkspaceEditBuilderTextEdits(t *testing.T) {
+	uri := DocumentURI("file:///a.go")
+	span := func(startLine, startCharacter, endLine, endCharacter int) Range {
+		return Range{
+			Start: Position{Line: startLine, Character: startCharacter},
+			End:   Position{Line: endLine, Character: endCharacter},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		build    func(builder *WorkspaceEditBuilder)
+		expected []TextEdit
+	}{
+		{
+			"sorted",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Replace(span(2, 0, 2, 3), "c").Replace(span(0, 0, 0, 1), "a")
+			},
+			[]TextEdit{{Range: span(0, 0, 0, 1), NewText: "a"}, {Range: span(2, 0, 2, 3), NewText: "c"}},
+		},
+		{
+			"adjacent edits merged",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Replace(span(0, 2, 0, 4), "b").Replace(span(0, 0, 0, 2), "a")
+			},
+			[]TextEdit{{Range: span(0, 0, 0, 4), NewText: "ab"}},
+		},
+		{
+			"inserts keep their order",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Insert(Position{Line: 1}, "a").Insert(Position{Line: 1}, "b")
+			},
+			[]TextEdit{{Range: span(1, 0, 1, 0), NewText: "ab"}},
+		},
+		{
+			"insert before replace",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Insert(Position{Line: 1}, "a").Replace(span(1, 0, 1, 2), "b")
+			},
+			[]TextEdit{{Range: span(1, 0, 1, 2), NewText: "ab"}},
+		},
+		{
+			"insert after replace",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Replace(span(1, 0, 1, 2), "b").Insert(Position{Line: 1}, "a")
+			},
+			[]TextEdit{{Range: span(1, 0, 1, 2), NewText: "ab"}},
+		},
+		{
+			"insert at the end of replace",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Insert(Position{Line: 1, Character: 2}, "c").Replace(span(1, 0, 1, 2), "b")
+			},
+			[]TextEdit{{Range: span(1, 0, 1, 2), NewText: "bc"}},
+		},
+		{
+			"annotated edits kept apart",
+			func(builder *WorkspaceEditBuilder) {
+				builder.Replace(span(1, 0, 1, 2), "b").Annotate("Insert", false).Insert(Position{Line: 1}, "a")
+			},
+			[]TextEdit{
+				{Range: span(1, 0, 1, 0), NewText: "a", AnnotationID: "Insert"},
+				{Range: span(1, 0, 1, 2), NewText: "b"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		builder := NewWorkspaceEditBuilder().Edit(uri, 3)
+		test.build(builder)
+
+		edit, err := builder.DocumentChanges()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		expected := []WorkspaceEditDocumentChange{
+			TextDocumentEdit{
+				TextDocument: VersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+					Version:                3,
+				},
+				Edits: test.expected,
+			},
+		}
+
+		if !reflect.DeepEqual(edit.DocumentChanges, expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, expected, edit.DocumentChanges)
+		}
+	}
+}
+
+func TestWorkspaceEditBuilderErrors(t *testing.T) {
+	uri := DocumentURI("file:///a.go")
+	line := func(line, start, end int) Range {
+		return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+	}
+
+	tests := map[string]*WorkspaceEditBuilder{
+		"overlapping edits": NewWorkspaceEditBuilder().Edit(uri, 0).
+			Replace(line(0, 0, 4), "a").Replace(line(0, 3, 5), "b"),
+		"edits at the same range": NewWorkspaceEditBuilder().Edit(uri, 0).
+			Replace(line(0, 0, 4), "a").Replace(line(0, 0, 4), "b"),
+		"insert inside of replace": NewWorkspaceEditBuilder().Edit(uri, 0).
+			Replace(line(0, 0, 4), "a").Insert(Position{Character: 2}, "b"),
+		"invalid range": NewWorkspaceEditBuilder().Edit(uri, 0).
+			Replace(Range{Start: Position{Line: 1}, End: Position{Line: 0}}, "a"),
+		"no document selected": NewWorkspaceEditBuilder().
+			Insert(Position{}, "a"),
+		"conflicting versions": NewWorkspaceEditBuilder().
+			Edit(uri, 1).Edit(uri, 2),
+		"undefined annotation": NewWorkspaceEditBuilder().Edit(uri, 0).
+			UseAnnotation("unknown").Insert(Position{}, "a"),
+	}
+
+	for name, builder := range tests {
+		if _, err := builder.DocumentChanges(); err == nil {
+			t.Errorf("%s: expected DocumentChanges to fail", name)
+		}
+
+		if _, err := builder.Changes(); err == nil {
+			t.Errorf("%s: expected Changes to fail", name)
+		}
+	}
+
+	// Edits made after a resource operation address the document as it is
+	// after the operation, so they don't overlap with the ones made before.
+	_, err := NewWorkspaceEditBuilder().
+		Edit(uri, 0).Replace(line(0, 0, 4), "a").
+		CreateFile("file:///b.go", CreateFileOptions{}).
+		Edit(uri, 0).Replace(line(0, 0, 4), "b").
+		DocumentChanges()
+	if err != nil {
+		t.Errorf("expected edits separated by a resource operation to be accepted, got %v", err)
+	}
+}
+
+func TestWorkspaceEditBuilderAnnotations(t *testing.T) {
+	builder := NewWorkspaceEditBuilder().
+		DefineAnnotation("unused", ChangeAnnotation{Label: "Unused"}).
+		Edit("file:///a.go", 0).
+		Annotate("Rename", false).Insert(Position{Line: 0}, "a").
+		Annotate("Rename", true).Insert(Position{Line: 1}, "b").
+		Annotate("Rename", false).Insert(Position{Line: 2}, "c").
+		Annotate("", false).Insert(Position{Line: 3}, "d")
+
+	edit, err := builder.DocumentChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[ChangeAnnotationIdentifier]*ChangeAnnotation{
+		"Rename":   {Label: "Rename"},
+		"Rename#2": {Label: "Rename", NeedsConfirmation: true},
+	}
+
+	if !reflect.DeepEqual(edit.ChangeAnnotations, expected) {
+		t.Errorf("expected annotations %+v, got %+v", expected, edit.ChangeAnnotations)
+	}
+
+	var ids []ChangeAnnotationIdentifier
+	for _, edit := range edit.DocumentChanges[0].(TextDocumentEdit).Edits {
+		ids = append(ids, edit.AnnotationID)
+	}
+
+	if expected := []ChangeAnnotationIdentifier{"Rename", "Rename#2", "Rename", ""}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected annotation ids %v, got %v", expected, ids)
+	}
+}
+
+func TestWorkspaceEditBuilderChanges(t *testing.T) {
+	a := DocumentURI("file:///a.go")
+	b := DocumentURI("file:///b.go")
+
+	edit, err := NewWorkspaceEditBuilder().
+		Edit(a, 1).Insert(Position{Line: 1}, "y").
+		Edit(b, 0).
+		Edit(a, 1).Insert(Position{Line: 0}, "x").
+		Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := WorkspaceEdit{
+		Changes: map[DocumentURI][]TextEdit{
+			a: {
+				{Range: Range{Start: Position{Line: 0}, End: Position{Line: 0}}, NewText: "x"},
+				{Range: Range{Start: Position{Line: 1}, End: Position{Line: 1}}, NewText: "y"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(edit, expected) {
+		t.Errorf("expected %+v, got %+v", expected, edit)
+	}
+
+	_, err = NewWorkspaceEditBuilder().
+		Edit(a, 0).Insert(Position{}, "x").
+		DeleteFile(b, DeleteFileOptions{}).
+		Changes()
+	if err == nil {
+		t.Error("expected resource operations not to be expressible as changes")
+	}
+}
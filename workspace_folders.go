@@ -0,0 +1,212 @@
+package lsp
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// WorkspaceFolderSubscriber is called with the folders that were added to or
+// removed from a WorkspaceFolderManager.
+type WorkspaceFolderSubscriber func(event WorkspaceFoldersChangeEvent)
+
+// WorkspaceFolderManager keeps track of the workspace folders open in the
+// client. It's seeded from the `initialize` request, updated by
+// `workspace/didChangeWorkspaceFolders` notifications, and tells which folder
+// a document belongs to. Subscribers are notified whenever folders are added
+// or removed, e.g. to start and stop per-folder indexes.
+//
+// Folders are compared by their normalized URIs (see `DocumentURI.Normalize`).
+// A WorkspaceFolderManager is safe for concurrent use.
+type WorkspaceFolderManager struct {
+	// Held while applying changes and notifying subscribers, so that
+	// notifications are delivered in the order the changes were applied in.
+	notifying sync.Mutex
+
+	mu sync.RWMutex
+
+	folders       []WorkspaceFolder
+	subscriptions []workspaceFolderSubscription
+	lastID        int
+}
+
+// workspaceFolderSubscription is a subscriber along with the ID used to
+// unsubscribe it.
+type workspaceFolderSubscription struct {
+	id         int
+	subscriber WorkspaceFolderSubscriber
+}
+
+// NewWorkspaceFolderManager instantiates an empty WorkspaceFolderManager.
+func NewWorkspaceFolderManager() *WorkspaceFolderManager {
+	return &WorkspaceFolderManager{}
+}
+
+// Initialize seeds the manager from the parameters of an `initialize`
+// request. It uses `WorkspaceFolders` if set, and falls back to the deprecated
+// `RootURI` and `RootPath` otherwise. Folders the manager already knows are
+// removed first.
+func (manager *WorkspaceFolderManager) Initialize(params *InitializeParams) {
+	folders := params.WorkspaceFolders
+
+	if len(folders) == 0 {
+		root := params.RootURI
+		if root == "" && params.RootPath != "" {
+			// A relative root path can't be resolved, so it's ignored.
+			root, _ = FromPath(params.RootPath, NativePathStyle)
+		}
+
+		if root != "" {
+			folders = []WorkspaceFolder{{URI: string(root), Name: workspaceFolderName(root)}}
+		}
+	}
+
+	manager.apply(WorkspaceFoldersChangeEvent{Added: folders}, true)
+}
+
+// DidChangeWorkspaceFolders applies the changes of a
+// `workspace/didChangeWorkspaceFolders` notification.
+func (manager *WorkspaceFolderManager) DidChangeWorkspaceFolders(params *DidChangeWorkspaceFoldersParams) {
+	manager.Apply(params.Event)
+}
+
+// Apply removes and adds workspace folders. Removed folders that aren't known
+// and added folders that are known already are ignored. Subscribers are
+// notified of the effective changes, if there are any, before Apply returns.
+func (manager *WorkspaceFolderManager) Apply(event WorkspaceFoldersChangeEvent) {
+	manager.apply(event, false)
+}
+
+// apply implements `Apply`. If replace is set, all known folders are removed
+// before the ones of the event are added.
+func (manager *WorkspaceFolderManager) apply(event WorkspaceFoldersChangeEvent, replace bool) {
+	manager.notifying.Lock()
+	defer manager.notifying.Unlock()
+
+	manager.mu.Lock()
+
+	if replace {
+		event.Removed = append([]WorkspaceFolder{}, manager.folders...)
+	}
+
+	effective := WorkspaceFoldersChangeEvent{
+		Added:   []WorkspaceFolder{},
+		Removed: []WorkspaceFolder{},
+	}
+
+	for _, removed := range event.Removed {
+		if index := manager.indexOf(DocumentURI(removed.URI)); index >= 0 {
+			effective.Removed = append(effective.Removed, manager.folders[index])
+			manager.folders = append(manager.folders[:index], manager.folders[index+1:]...)
+		}
+	}
+
+	for _, added := range event.Added {
+		if manager.indexOf(DocumentURI(added.URI)) < 0 {
+			effective.Added = append(effective.Added, added)
+			manager.folders = append(manager.folders, added)
+		}
+	}
+
+	subscriptions := manager.subscriptions
+
+	manager.mu.Unlock()
+
+	if len(effective.Added) == 0 && len(effective.Removed) == 0 {
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		subscription.subscriber(effective)
+	}
+}
+
+// Folders returns the current workspace folders, in the order they were
+// added in.
+func (manager *WorkspaceFolderManager) Folders() []WorkspaceFolder {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	return append([]WorkspaceFolder{}, manager.folders...)
+}
+
+// FolderFor returns the workspace folder a document belongs to. If folders are
+// nested, the innermost one wins. The second return value is false if the
+// document is outside of every workspace folder.
+func (manager *WorkspaceFolderManager) FolderFor(uri DocumentURI) (WorkspaceFolder, bool) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	document := string(uri.Normalize())
+
+	var owner WorkspaceFolder
+	longest := -1
+
+	for _, folder := range manager.folders {
+		prefix := string(DocumentURI(folder.URI).Normalize())
+		if len(prefix) <= longest {
+			continue
+		}
+
+		if document == prefix || strings.HasPrefix(document, strings.TrimSuffix(prefix, "/")+"/") {
+			owner = folder
+			longest = len(prefix)
+		}
+	}
+
+	return owner, longest >= 0
+}
+
+// Subscribe registers a function that's called after folders have been added
+// or removed. Subscribers are called in the order they subscribed in, on the
+// goroutine that changed the folders, and one change at a time, so they must
+// not change the folders themselves. The returned function unsubscribes.
+func (manager *WorkspaceFolderManager) Subscribe(subscriber WorkspaceFolderSubscriber) func() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.lastID++
+	id := manager.lastID
+
+	manager.subscriptions = append(manager.subscriptions, workspaceFolderSubscription{
+		id:         id,
+		subscriber: subscriber,
+	})
+
+	return func() {
+		manager.mu.Lock()
+		defer manager.mu.Unlock()
+
+		// The slice is copied, so notifications that are in progress keep
+		// seeing the subscriptions they started with.
+		subscriptions := []workspaceFolderSubscription{}
+		for _, subscription := range manager.subscriptions {
+			if subscription.id != id {
+				subscriptions = append(subscriptions, subscription)
+			}
+		}
+
+		manager.subscriptions = subscriptions
+	}
+}
+
+// indexOf returns the index of a folder, or -1 if it isn't known.
+func (manager *WorkspaceFolderManager) indexOf(uri DocumentURI) int {
+	for i, folder := range manager.folders {
+		if uri.Equal(DocumentURI(folder.URI)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// workspaceFolderName derives the name of a workspace folder from its URI.
+func workspaceFolderName(uri DocumentURI) string {
+	parsed, err := ParseURI(string(uri))
+	if err != nil {
+		return string(uri)
+	}
+
+	return path.Base(parsed.Path)
+}
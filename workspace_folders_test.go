@@ -0,0 +1,176 @@
+package lsp
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestWorkspaceFolderManagerInitialize(t *testing.T) {
+	tests := []struct {
+		params   InitializeParams
+		expected []WorkspaceFolder
+	}{
+		{
+			InitializeParams{
+				WorkspaceFolders: []WorkspaceFolder{{URI: "file:///a", Name: "a"}, {URI: "file:///b", Name: "b"}},
+				RootURI:          "file:///root",
+			},
+			[]WorkspaceFolder{{URI: "file:///a", Name: "a"}, {URI: "file:///b", Name: "b"}},
+		},
+		{
+			InitializeParams{RootURI: "file:///src/project", RootPath: "/other"},
+			[]WorkspaceFolder{{URI: "file:///src/project", Name: "project"}},
+		},
+		{
+			InitializeParams{RootPath: "relative/project"},
+			[]WorkspaceFolder{},
+		},
+		{
+			InitializeParams{},
+			[]WorkspaceFolder{},
+		},
+	}
+
+	for _, test := range tests {
+		manager := NewWorkspaceFolderManager()
+		manager.Apply(WorkspaceFoldersChangeEvent{Added: []WorkspaceFolder{{URI: "file:///old", Name: "old"}}})
+
+		manager.Initialize(&test.params)
+
+		if folders := manager.Folders(); !reflect.DeepEqual(folders, test.expected) {
+			t.Errorf("%+v: expected %+v, got %+v", test.params, test.expected, folders)
+		}
+	}
+}
+
+func TestWorkspaceFolderManagerApply(t *testing.T) {
+	manager := NewWorkspaceFolderManager()
+
+	var events []WorkspaceFoldersChangeEvent
+	unsubscribe := manager.Subscribe(func(event WorkspaceFoldersChangeEvent) {
+		events = append(events, event)
+	})
+
+	a := WorkspaceFolder{URI: "file:///a", Name: "a"}
+	b := WorkspaceFolder{URI: "file:///b", Name: "b"}
+
+	manager.Apply(WorkspaceFoldersChangeEvent{Added: []WorkspaceFolder{a, b}})
+	manager.Apply(WorkspaceFoldersChangeEvent{
+		Added:   []WorkspaceFolder{{URI: "file:///b/../a", Name: "duplicate"}},
+		Removed: []WorkspaceFolder{{URI: "file:///unknown"}},
+	})
+	manager.DidChangeWorkspaceFolders(&DidChangeWorkspaceFoldersParams{
+		Event: WorkspaceFoldersChangeEvent{Removed: []WorkspaceFolder{{URI: "file:///a/"}}},
+	})
+
+	expected := []WorkspaceFoldersChangeEvent{
+		{Added: []WorkspaceFolder{a, b}, Removed: []WorkspaceFolder{}},
+		{Added: []WorkspaceFolder{}, Removed: []WorkspaceFolder{a}},
+	}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected events %+v, got %+v", expected, events)
+	}
+
+	if folders := manager.Folders(); !reflect.DeepEqual(folders, []WorkspaceFolder{b}) {
+		t.Errorf("expected folders %+v, got %+v", []WorkspaceFolder{b}, folders)
+	}
+
+	unsubscribe()
+	manager.Apply(WorkspaceFoldersChangeEvent{Added: []WorkspaceFolder{a}})
+
+	if len(events) != 2 {
+		t.Errorf("expected no events after unsubscribing, got %+v", events[2:])
+	}
+}
+
+func TestWorkspaceFolderManagerFolderFor(t *testing.T) {
+	manager := NewWorkspaceFolderManager()
+	manager.Apply(WorkspaceFoldersChangeEvent{Added: []WorkspaceFolder{
+		{URI: "file:///src/project/sub", Name: "sub"},
+		{URI: "file:///src/project", Name: "project"},
+	}})
+
+	tests := []struct {
+		uri      DocumentURI
+		expected string
+	}{
+		{"file:///src/project/main.go", "project"},
+		{"file:///src/project/sub/main.go", "sub"},
+		{"file:///src/project/sub", "sub"},
+		{"file:///src/project/subway/main.go", "project"},
+		{"file:///src/projects/main.go", ""},
+		{"file:///other/main.go", ""},
+	}
+
+	for _, test := range tests {
+		folder, ok := manager.FolderFor(test.uri)
+		if ok != (test.expected != "") || folder.Name != test.expected {
+			t.Errorf("%s: expected folder %q, got %q (%t)", test.uri, test.expected, folder.Name, ok)
+		}
+	}
+}
+
+func TestWorkspaceFolderManagerNotificationOrder(t *testing.T) {
+	manager := NewWorkspaceFolderManager()
+
+	// The subscriber replays the events. If they were delivered out of order,
+	// the folders it ends up with would differ from the ones of the manager.
+	// Yielding before taking the lock gives events that are delivered
+	// concurrently the chance to overtake each other.
+	var mu sync.Mutex
+	replayed := map[string]bool{}
+	manager.Subscribe(func(event WorkspaceFoldersChangeEvent) {
+		runtime.Gosched()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, folder := range event.Removed {
+			if !replayed[folder.URI] {
+				t.Errorf("%s has been removed before it was added", folder.URI)
+			}
+
+			delete(replayed, folder.URI)
+		}
+
+		for _, folder := range event.Added {
+			if replayed[folder.URI] {
+				t.Errorf("%s has been added twice", folder.URI)
+			}
+
+			replayed[folder.URI] = true
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			folder := WorkspaceFolder{URI: fmt.Sprintf("file:///%d", i%2)}
+			for j := 0; j < 200; j++ {
+				manager.Apply(WorkspaceFoldersChangeEvent{Added: []WorkspaceFolder{folder}})
+				manager.Apply(WorkspaceFoldersChangeEvent{Removed: []WorkspaceFolder{folder}})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	folders := manager.Folders()
+	if len(folders) != len(replayed) {
+		t.Fatalf("expected the replayed folders %v to match %+v", replayed, folders)
+	}
+
+	for _, folder := range folders {
+		if !replayed[folder.URI] {
+			t.Errorf("expected the replayed folders %v to match %+v", replayed, folders)
+		}
+	}
+}